@@ -0,0 +1,143 @@
+// Command envoy-authz runs an Envoy external authorization server that authorizes requests using an Aserto
+// authorizer.
+//
+// Configure Envoy's ext_authz HTTP filter to use the server as its gRPC service:
+//
+//  envoy-authz -addr :9191 -authorizer authorizer.prod.aserto.com:8443 -tenant <tenant ID> -api-key <API key> \
+//    -policy-id <policy ID> -policy-root myapp -route "GET /products/*=myapp.products.read" \
+//    -ok-header x-authorized=true
+//
+// Envoy doesn't send route templates, so policy paths built from URLs hold the raw path (e.g.
+// "myapp.GET.products.123"). Use -route to evaluate the same policy path for all URLs that match a pattern.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc"
+
+	authz "github.com/aserto-dev/aserto-go/authorizer/grpc"
+	"github.com/aserto-dev/aserto-go/client"
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/envoy"
+)
+
+// headers is a flag that can be repeated to specify "name=value" headers.
+type headers [][2]string
+
+func (h *headers) String() string {
+	values := make([]string, len(*h))
+	for i, header := range *h {
+		values[i] = header[0] + "=" + header[1]
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (h *headers) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header '%s', expected name=value", value)
+	}
+
+	*h = append(*h, [2]string{name, val})
+
+	return nil
+}
+
+// routes is a flag that can be repeated to specify "METHOD /pattern=policy.path" route policies.
+type routes [][3]string
+
+func (r *routes) String() string {
+	values := make([]string, len(*r))
+	for i, route := range *r {
+		values[i] = route[0] + " " + route[1] + "=" + route[2]
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (r *routes) Set(value string) error {
+	route, path, ok := strings.Cut(value, "=")
+	method, pattern, hasMethod := strings.Cut(route, " ")
+
+	if !hasMethod {
+		method, pattern = "", route
+	}
+
+	if !ok || path == "" || !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("invalid route '%s', expected [METHOD ]/pattern=policy.path", value)
+	}
+
+	*r = append(*r, [3]string{method, pattern, path})
+
+	return nil
+}
+
+func main() {
+	var (
+		okHeaders, deniedHeaders headers
+		routePolicies            routes
+	)
+
+	addr := flag.String("addr", ":9191", "address to listen on")
+	authorizerAddr := flag.String("authorizer", "localhost:8282", "address of the authorizer")
+	insecure := flag.Bool("insecure", false, "skip verification of the authorizer's TLS certificate")
+	apiKey := flag.String("api-key", "", "authorizer API key")
+	tenantID := flag.String("tenant", "", "tenant ID")
+	policyID := flag.String("policy-id", "", "ID of the policy to evaluate")
+	policyRoot := flag.String("policy-root", "", "prefix of the policy paths built from request URLs")
+	decision := flag.String("decision", "allowed", "name of the policy decision to evaluate")
+	identityHeader := flag.String("identity-header", "Authorization", "header that holds the caller's identity")
+	flag.Var(&okHeaders, "ok-header", "name=value header added to allowed requests (can be repeated)")
+	flag.Var(&deniedHeaders, "denied-header", "name=value header added to denied responses (can be repeated)")
+	flag.Var(&routePolicies, "route", "'METHOD /pattern=policy.path' route policy (can be repeated)")
+	flag.Parse()
+
+	options := []client.ConnectionOption{client.WithAddr(*authorizerAddr), client.WithInsecure(*insecure)}
+	if *apiKey != "" {
+		options = append(options, client.WithAPIKeyAuth(*apiKey))
+	}
+
+	if *tenantID != "" {
+		options = append(options, client.WithTenantID(*tenantID))
+	}
+
+	authClient, err := authz.New(context.Background(), options...)
+	if err != nil {
+		log.Fatalln("Failed to create authorizer client:", err)
+	}
+
+	srv := envoy.New(authClient, middleware.Policy{ID: *policyID, Decision: *decision})
+	srv.HTTP.Identity.FromHeader(*identityHeader)
+	srv.HTTP.WithPolicyFromURL(*policyRoot)
+
+	for _, route := range routePolicies {
+		srv.HTTP.WithRoutePolicy(route[0], route[1], route[2])
+	}
+
+	for _, header := range okHeaders {
+		srv.WithOKHeader(header[0], header[1])
+	}
+
+	for _, header := range deniedHeaders {
+		srv.WithDeniedHeader(header[0], header[1])
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalln("Failed to listen:", err)
+	}
+
+	s := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(s, srv)
+
+	log.Println("Starting Envoy authorization server on", *addr)
+	log.Fatal(s.Serve(lis))
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/x509"
+)
+
+const spiffeScheme = "spiffe"
+
+// CertificateSelector functions extract a caller's subject from an X.509 client certificate.
+// They are used to identify callers of services that authenticate clients using mutual TLS.
+// A selector returns an empty string if the certificate doesn't have the requested field.
+type CertificateSelector func(*x509.Certificate) string
+
+// CommonName selects the common name (CN) of a certificate's subject.
+func CommonName(cert *x509.Certificate) string {
+	return cert.Subject.CommonName
+}
+
+// EmailSAN selects the first email address in a certificate's subject alternative names.
+func EmailSAN(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) == 0 {
+		return ""
+	}
+
+	return cert.EmailAddresses[0]
+}
+
+// URISAN selects the first URI in a certificate's subject alternative names.
+func URISAN(cert *x509.Certificate) string {
+	if len(cert.URIs) == 0 {
+		return ""
+	}
+
+	return cert.URIs[0].String()
+}
+
+// SPIFFEID selects the SPIFFE ID of an X.509 SVID, which is the URI subject alternative name with the "spiffe"
+// scheme (e.g. "spiffe://example.org/service").
+func SPIFFEID(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == spiffeScheme {
+			return uri.String()
+		}
+	}
+
+	return ""
+}
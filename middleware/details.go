@@ -0,0 +1,29 @@
+package middleware
+
+// DenialDetails describes why a request was denied by the authorizer.
+type DenialDetails struct {
+	// PolicyPath is the path of the policy that was evaluated.
+	PolicyPath string `json:"policy_path,omitempty"`
+
+	// Decision is the name of the decision that evaluated to false.
+	Decision string `json:"decision,omitempty"`
+
+	// Reason is the value of the policy's "reason" rule, if it has one and it evaluates to a string.
+	Reason string `json:"reason,omitempty"`
+
+	// Outputs holds the values of all rules in the policy package. It is only set if
+	// DenialDetailsOptions.IncludeOutputs is true.
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
+}
+
+// DenialDetailsOptions configure the details that middleware includes in responses to denied requests.
+type DenialDetailsOptions struct {
+	// IncludeOutputs instructs the middleware to include the values of all rules in the policy package in the
+	// details. The rules are queried for every denied request to find the policy's reason, which requires an
+	// additional call to the authorizer, so this option doesn't add any calls.
+	IncludeOutputs bool
+
+	// Redact is called with the details of each denied request before they are sent to the caller.
+	// It can remove or replace sensitive information. Setting a field to its zero value omits it from the response.
+	Redact func(*DenialDetails)
+}
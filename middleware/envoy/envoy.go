@@ -0,0 +1,228 @@
+/*
+Package envoy provides an Envoy external authorization server backed by Aserto authorizers.
+
+The server implements Envoy's `envoy.service.auth.v3.Authorization` gRPC service. Envoy's ext_authz filter sends
+the attributes of each HTTP request to the server, which authorizes them the same way as the net/http middleware:
+the identity is read from request headers, the policy path is determined by the middleware's policy mapper and
+route policies, and the resource context is built by the middleware's resource mappers.
+
+Requests sent by Envoy aren't routed by the server, so there are no route templates or path parameters. The default
+policy mapper builds paths from the raw URL path, which gives one path per resource, such as
+"myapp.GET.products.123". Map URL patterns to policy paths with `WithRoutePolicy()`, or set a custom policy mapper:
+
+  srv := envoy.New(authClient.Authorizer, middleware.Policy{ID: "policyId", Decision: "allowed"})
+  srv.HTTP.WithRoutePolicy("GET", "/products/*", "myapp.products.read")
+
+  s := grpc.NewServer()
+  authv3.RegisterAuthorizationServer(s, srv)
+*/
+package envoy
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/http/std"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/pkg/errors"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+type (
+	Policy           = middleware.Policy
+	AuthorizerClient = authorizer.AuthorizerClient
+)
+
+// ErrNoHTTPAttributes is returned for check requests that don't hold the attributes of an HTTP request.
+var ErrNoHTTPAttributes = errors.New("check request has no http attributes")
+
+/*
+Server is an Envoy external authorization server.
+
+Check requests are translated to HTTP requests and authorized by the server's HTTP middleware. Requests that the
+middleware lets through are allowed, and all other requests are denied with the response written by the middleware.
+*/
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+
+	// HTTP authorizes the requests sent by Envoy. Use it to configure the identity, policy path, and resource used in
+	// authorization calls.
+	HTTP *std.Middleware
+
+	okHeaders     []*corev3.HeaderValueOption
+	deniedHeaders []*corev3.HeaderValueOption
+}
+
+var _ authv3.AuthorizationServer = (*Server)(nil)
+
+// New creates an authorization server for the specified policy.
+//
+// The server is created with the same defaults as the net/http middleware. The caller's identity is read from the
+// "Authorization" header, and if the policy has no path, the policy path is built from the request's method and raw
+// URL path. Use `HTTP.WithRoutePolicy()` or a custom policy mapper to evaluate the same path for all URLs of a route.
+func New(client AuthorizerClient, policy Policy) *Server {
+	return &Server{HTTP: std.New(client, policy)}
+}
+
+// WithOKHeader adds a header to the requests that are allowed. Envoy adds the header to the request before sending
+// it upstream, replacing existing values.
+func (s *Server) WithOKHeader(name, value string) *Server {
+	s.okHeaders = append(s.okHeaders, headerValue(name, value))
+	return s
+}
+
+// WithDeniedHeader adds a header to the responses sent by Envoy to clients whose requests are denied.
+func (s *Server) WithDeniedHeader(name, value string) *Server {
+	s.deniedHeaders = append(s.deniedHeaders, headerValue(name, value))
+	return s
+}
+
+// Check authorizes a request received by Envoy.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	r, err := httpRequest(ctx, req.GetAttributes())
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	w := newResponseRecorder()
+
+	s.HTTP.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		allowed = true
+	})).ServeHTTP(w, r)
+
+	if allowed {
+		return &authv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{
+				OkResponse: &authv3.OkHttpResponse{Headers: s.okHeaders},
+			},
+		}, nil
+	}
+
+	return s.denied(w), nil
+}
+
+func (s *Server) denied(w *responseRecorder) *authv3.CheckResponse {
+	headers := make([]*corev3.HeaderValueOption, 0, len(w.header)+len(s.deniedHeaders))
+	for name, values := range w.header {
+		headers = append(headers, headerValue(name, strings.Join(values, ", ")))
+	}
+
+	headers = append(headers, s.deniedHeaders...)
+
+	status := w.status
+	if status < http.StatusBadRequest {
+		// The middleware neither let the request through nor wrote an error. Don't deny it with a successful status.
+		status = http.StatusInternalServerError
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(grpcCode(status))},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(status)},
+				Headers: headers,
+				Body:    w.body.String(),
+			},
+		},
+	}
+}
+
+// httpRequest translates the HTTP attributes of a check request to an *http.Request.
+func httpRequest(ctx context.Context, attrs *authv3.AttributeContext) (*http.Request, error) {
+	attr := attrs.GetRequest().GetHttp()
+	if attr == nil {
+		return nil, ErrNoHTTPAttributes
+	}
+
+	// The path attribute is the request target, including the query string.
+	target, err := url.ParseRequestURI(attr.GetPath())
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid request path '%s'", attr.GetPath())
+	}
+
+	target.Scheme = attr.GetScheme()
+	target.Host = attr.GetHost()
+
+	body := attr.GetRawBody()
+	if body == nil {
+		body = []byte(attr.GetBody())
+	}
+
+	r, err := http.NewRequestWithContext(ctx, attr.GetMethod(), target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+
+	for name, value := range attr.GetHeaders() {
+		// Envoy sends pseudo-headers (e.g. ":authority") alongside regular headers.
+		if !strings.HasPrefix(name, ":") {
+			r.Header.Set(name, value)
+		}
+	}
+
+	if address := attrs.GetSource().GetAddress().GetSocketAddress(); address != nil {
+		r.RemoteAddr = net.JoinHostPort(
+			address.GetAddress(),
+			strconv.FormatUint(uint64(address.GetPortValue()), 10),
+		)
+	}
+
+	return r, nil
+}
+
+func headerValue(name, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// grpcCode returns the status code of a check response that denies a request with the specified HTTP error status.
+// The middleware only responds with 400, 401, 403, and 500, so other statuses are treated as server errors.
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	default:
+		return codes.Internal
+	}
+}
+
+// responseRecorder captures the response written by the HTTP middleware when it denies a request.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+}
@@ -0,0 +1,129 @@
+package envoy_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/envoy"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func checkRequest(method, path string, headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  method,
+					Path:    path,
+					Host:    "example.com",
+					Scheme:  "https",
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func headers(options []*corev3.HeaderValueOption) map[string]string {
+	values := map[string]string{}
+	for _, option := range options {
+		values[option.Header.Key] = option.Header.Value
+	}
+
+	return values
+}
+
+func TestAllowed(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.GET.products"), test.Resource(resource))
+	srv := envoy.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithOKHeader("x-authorized", "true")
+	srv.HTTP.WithPolicyFromURL("myapp").WithResourceFromQuery("id")
+
+	resp, err := srv.Check(context.Background(), checkRequest(
+		"GET",
+		"/products?id=123",
+		map[string]string{":authority": "example.com", "authorization": test.DefaultUsername},
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(codes.OK), resp.Status.Code)
+	require.NotNil(t, resp.GetOkResponse())
+	assert.Equal(t, map[string]string{"x-authorized": "true"}, headers(resp.GetOkResponse().Headers))
+}
+
+func TestDenied(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.DELETE.products.123"))
+	srv := envoy.New(mock.New(t, expected, test.Decision(false)), test.Policy("")).WithDeniedHeader("x-denied", "true")
+	srv.HTTP.WithPolicyFromURL("myapp")
+
+	resp, err := srv.Check(
+		context.Background(),
+		checkRequest("DELETE", "/products/123", map[string]string{"authorization": test.DefaultUsername}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(codes.PermissionDenied), resp.Status.Code)
+
+	denied := resp.GetDeniedResponse()
+	require.NotNil(t, denied)
+	assert.Equal(t, http.StatusForbidden, int(denied.Status.Code))
+	assert.Equal(t, "true", headers(denied.Headers)["x-denied"])
+	assert.Contains(t, denied.Body, http.StatusText(http.StatusForbidden))
+}
+
+func TestRoutePolicy(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.products.read"))
+	srv := envoy.New(mock.New(t, expected, test.Decision(true)), test.Policy(""))
+	srv.HTTP.WithRoutePolicy("GET", "/products/*", "myapp.products.read")
+
+	for _, path := range []string{"/products/123", "/products/456"} {
+		resp, err := srv.Check(
+			context.Background(),
+			checkRequest("GET", path, map[string]string{"authorization": test.DefaultUsername}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int32(codes.OK), resp.Status.Code)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	ctx := context.Background()
+
+	jwks := test.NewJWKS(t)
+	verifier, err := middleware.NewJWKSVerifier(ctx, jwks.URL, middleware.JWTVerifierOptions{Issuer: test.Issuer})
+	require.NoError(t, err)
+
+	srv := envoy.New(mock.New(t, nil), test.Policy("myapp"))
+	srv.HTTP.Identity.VerifyJWT(verifier)
+
+	resp, err := srv.Check(
+		ctx,
+		checkRequest("GET", "/products", map[string]string{"authorization": "Bearer not-a-jwt"}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(codes.Unauthenticated), resp.Status.Code)
+
+	denied := resp.GetDeniedResponse()
+	require.NotNil(t, denied)
+	assert.Equal(t, http.StatusUnauthorized, int(denied.Status.Code))
+	assert.Contains(t, headers(denied.Headers), "Www-Authenticate")
+}
+
+func TestNoHTTPAttributes(t *testing.T) {
+	srv := envoy.New(mock.New(t, nil), test.Policy("myapp"))
+
+	_, err := srv.Check(context.Background(), &authv3.CheckRequest{})
+	assert.ErrorIs(t, err, envoy.ErrNoHTTPAttributes)
+}
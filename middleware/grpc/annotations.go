@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aserto-dev/aserto-go/middleware/grpc/authzpb"
+	"github.com/aserto-dev/aserto-go/middleware/internal/pbutil"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var (
+	// ErrMissingAnnotation is returned from Validate when annotations are enabled and a registered method doesn't
+	// have an authorization rule.
+	ErrMissingAnnotation = errors.New("missing authorization rule")
+
+	// ErrInvalidAnnotation is returned from Validate when an authorization rule refers to fields that don't exist
+	// in the method's request message.
+	ErrInvalidAnnotation = errors.New("invalid authorization rule")
+
+	errUnknownMethod = errors.New("method descriptor not found")
+)
+
+// AnnotationResolver reads authorization rules declared in protobuf service definitions using the
+// `aserto.middleware.v1.rule` method option.
+type AnnotationResolver struct {
+	files *protoregistry.Files
+	rules sync.Map
+}
+
+// NewAnnotationResolver returns an AnnotationResolver that looks up method descriptors in the specified registry.
+// Generated protobuf code registers its descriptors in `protoregistry.GlobalFiles`.
+func NewAnnotationResolver(files *protoregistry.Files) *AnnotationResolver {
+	return &AnnotationResolver{files: files}
+}
+
+// Rule returns the authorization rule declared on a method, identified by its full name
+// (e.g. "/example.ExampleService/Method"). If the method has no rule, Rule returns nil.
+func (r *AnnotationResolver) Rule(method string) (*authzpb.Rule, error) {
+	if rule, ok := r.rules.Load(method); ok {
+		return rule.(*authzpb.Rule), nil
+	}
+
+	desc, err := r.methodDescriptor(method)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule *authzpb.Rule
+
+	if opts := desc.Options(); opts != nil && proto.HasExtension(opts, authzpb.E_Rule) {
+		rule, _ = proto.GetExtension(opts, authzpb.E_Rule).(*authzpb.Rule)
+	}
+
+	r.rules.Store(method, rule)
+
+	return rule, nil
+}
+
+func (r *AnnotationResolver) methodDescriptor(method string) (protoreflect.MethodDescriptor, error) {
+	sep := strings.LastIndex(method, "/")
+	if sep < 0 {
+		return nil, fmt.Errorf("%w: %s", errUnknownMethod, method)
+	}
+
+	desc, err := r.files.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(method[:sep], "/")))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errUnknownMethod, method)
+	}
+
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownMethod, method)
+	}
+
+	methodDesc := service.Methods().ByName(protoreflect.Name(method[sep+1:]))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("%w: %s", errUnknownMethod, method)
+	}
+
+	return methodDesc, nil
+}
+
+// validate checks that a method has an authorization rule and that its resource fields exist in the method's
+// request message.
+func (r *AnnotationResolver) validate(method string) error {
+	rule, err := r.Rule(method)
+	if err != nil {
+		return err
+	}
+
+	if rule == nil {
+		return fmt.Errorf("%w: %s", ErrMissingAnnotation, method)
+	}
+
+	if len(rule.ResourceFields) == 0 {
+		return nil
+	}
+
+	desc, err := r.methodDescriptor(method)
+	if err != nil {
+		return err
+	}
+
+	if err := pbutil.Validate(desc.Input(), rule.ResourceFields...); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	return nil
+}
+
+/*
+WithAnnotations instructs the middleware to authorize calls using rules declared in protobuf service definitions
+with the `aserto.middleware.v1.rule` method option (see package authzpb).
+
+The rule's policy path, decisions, and resource fields are used when authorizing calls to annotated methods, and
+methods with an exempt rule aren't authorized. Policies set with `WithMethodPolicies()` take precedence over
+annotations.
+
+Example:
+
+  middleware.WithAnnotations(grpcmw.NewAnnotationResolver(protoregistry.GlobalFiles))
+
+When annotations are enabled, `Validate()` reports registered methods that have no rule and aren't exempt or
+configured using `WithMethodPolicies()`.
+*/
+func (m *Middleware) WithAnnotations(resolver *AnnotationResolver) *Middleware {
+	m.annotations = resolver
+	return m
+}
+
+// annotatedRule returns the authorization rule declared on a method, or nil if annotations aren't enabled or the
+// method has no rule.
+func (m *Middleware) annotatedRule(method string) *authzpb.Rule {
+	if m.annotations == nil {
+		return nil
+	}
+
+	rule, err := m.annotations.Rule(method)
+	if err != nil {
+		return nil
+	}
+
+	return rule
+}
@@ -0,0 +1,141 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
+	"github.com/aserto-dev/aserto-go/middleware/grpc/authzpb"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const identityContextType = ".aserto.api.v1.IdentityContext"
+
+func annotatedMethod(name string, rule *authzpb.Rule) *descriptorpb.MethodDescriptorProto {
+	method := &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(identityContextType),
+		OutputType: proto.String(identityContextType),
+	}
+
+	if rule != nil {
+		method.Options = &descriptorpb.MethodOptions{}
+		proto.SetExtension(method.Options, authzpb.E_Rule, rule)
+	}
+
+	return method
+}
+
+func annotatedFiles(t *testing.T) *protoregistry.Files {
+	file, err := protodesc.NewFile(
+		&descriptorpb.FileDescriptorProto{
+			Name:       proto.String("example/example.proto"),
+			Package:    proto.String("example"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"aserto/api/v1/identity_context.proto"},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("ExampleService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					annotatedMethod("Get", &authzpb.Rule{
+						PolicyPath:     "example.get",
+						Decisions:      []string{test.DefaultDecision},
+						ResourceFields: []string{"identity"},
+					}),
+					annotatedMethod("Ping", &authzpb.Rule{Exempt: true}),
+					annotatedMethod("Unannotated", nil),
+				},
+			}},
+		},
+		protoregistry.GlobalFiles,
+	)
+	require.NoError(t, err)
+
+	files := &protoregistry.Files{}
+	require.NoError(t, files.RegisterFile(file))
+
+	return files
+}
+
+func TestAnnotations(t *testing.T) {
+	resolver := grpcmw.NewAnnotationResolver(annotatedFiles(t))
+
+	t.Run("rule should set policy path and resource", func(t *testing.T) {
+		resource, err := structpb.NewStruct(map[string]interface{}{"identity": test.DefaultUsername})
+		require.NoError(t, err)
+
+		client := mock.New(
+			t,
+			test.Request(test.PolicyPath("example.get"), test.Resource(resource)),
+			test.Decision(true),
+		)
+		mw := grpcmw.New(client, test.Policy("")).WithAnnotations(resolver)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		_, err = mw.Unary()(
+			context.Background(),
+			&api.IdentityContext{Identity: test.DefaultUsername},
+			&grpc.UnaryServerInfo{FullMethod: "/example.ExampleService/Get"},
+			func(_ context.Context, _ interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("exempt methods should not be authorized", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, nil), test.Policy("")).WithAnnotations(resolver)
+
+		assert.NoError(t, callMethod(mw, "/example.ExampleService/Ping"))
+	})
+
+	t.Run("validate should report missing annotations", func(t *testing.T) {
+		server := services{
+			"example.ExampleService": grpc.ServiceInfo{
+				Methods: []grpc.MethodInfo{{Name: "Get"}, {Name: "Ping"}, {Name: "Unannotated"}},
+			},
+		}
+
+		mw := grpcmw.New(mock.New(t, nil), test.Policy("")).WithAnnotations(resolver)
+		assert.ErrorIs(t, mw.Validate(server), grpcmw.ErrMissingAnnotation)
+
+		mw.WithExemptMethods("/example.ExampleService/Unannotated")
+		assert.NoError(t, mw.Validate(server))
+	})
+}
+
+func TestInvalidAnnotation(t *testing.T) {
+	file, err := protodesc.NewFile(
+		&descriptorpb.FileDescriptorProto{
+			Name:       proto.String("invalid/invalid.proto"),
+			Package:    proto.String("invalid"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"aserto/api/v1/identity_context.proto"},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("InvalidService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					annotatedMethod("Get", &authzpb.Rule{ResourceFields: []string{"no_such_field"}}),
+				},
+			}},
+		},
+		protoregistry.GlobalFiles,
+	)
+	require.NoError(t, err)
+
+	files := &protoregistry.Files{}
+	require.NoError(t, files.RegisterFile(file))
+
+	server := services{"invalid.InvalidService": grpc.ServiceInfo{Methods: []grpc.MethodInfo{{Name: "Get"}}}}
+	mw := grpcmw.New(mock.New(t, nil), test.Policy("")).WithAnnotations(grpcmw.NewAnnotationResolver(files))
+
+	assert.ErrorIs(t, mw.Validate(server), grpcmw.ErrInvalidAnnotation)
+}
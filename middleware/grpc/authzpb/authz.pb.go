@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: aserto/middleware/v1/authz.proto
+
+package authzpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Rule describes how calls to an RPC method are authorized.
+type Rule struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Package name of the rego policy to evaluate.
+	// If empty, the policy path is determined by the middleware's policy path mapper.
+	PolicyPath string `protobuf:"bytes,1,opt,name=policy_path,json=policyPath,proto3" json:"policy_path,omitempty"`
+	// Authorization decisions to evaluate. Calls are only allowed if all decisions are true.
+	// If empty, the middleware's decision is used.
+	Decisions []string `protobuf:"bytes,2,rep,name=decisions,proto3" json:"decisions,omitempty"`
+	// Paths of fields in the request message to include in the authorization resource context.
+	ResourceFields []string `protobuf:"bytes,3,rep,name=resource_fields,json=resourceFields,proto3" json:"resource_fields,omitempty"`
+	// Calls to methods that are exempt are not authorized.
+	Exempt bool `protobuf:"varint,4,opt,name=exempt,proto3" json:"exempt,omitempty"`
+}
+
+func (x *Rule) Reset() {
+	*x = Rule{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_aserto_middleware_v1_authz_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Rule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rule) ProtoMessage() {}
+
+func (x *Rule) ProtoReflect() protoreflect.Message {
+	mi := &file_aserto_middleware_v1_authz_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rule.ProtoReflect.Descriptor instead.
+func (*Rule) Descriptor() ([]byte, []int) {
+	return file_aserto_middleware_v1_authz_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Rule) GetPolicyPath() string {
+	if x != nil {
+		return x.PolicyPath
+	}
+	return ""
+}
+
+func (x *Rule) GetDecisions() []string {
+	if x != nil {
+		return x.Decisions
+	}
+	return nil
+}
+
+func (x *Rule) GetResourceFields() []string {
+	if x != nil {
+		return x.ResourceFields
+	}
+	return nil
+}
+
+func (x *Rule) GetExempt() bool {
+	if x != nil {
+		return x.Exempt
+	}
+	return false
+}
+
+var file_aserto_middleware_v1_authz_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*Rule)(nil),
+		Field:         51217,
+		Name:          "aserto.middleware.v1.rule",
+		Tag:           "bytes,51217,opt,name=rule",
+		Filename:      "aserto/middleware/v1/authz.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// Authorization rule applied by the aserto gRPC middleware to calls to the method.
+	//
+	// optional aserto.middleware.v1.Rule rule = 51217;
+	E_Rule = &file_aserto_middleware_v1_authz_proto_extTypes[0]
+)
+
+var File_aserto_middleware_v1_authz_proto protoreflect.FileDescriptor
+
+var file_aserto_middleware_v1_authz_proto_rawDesc = []byte{
+	0x0a, 0x20, 0x61, 0x73, 0x65, 0x72, 0x74, 0x6f, 0x2f, 0x6d, 0x69, 0x64, 0x64, 0x6c, 0x65, 0x77,
+	0x61, 0x72, 0x65, 0x2f, 0x76, 0x31, 0x2f, 0x61, 0x75, 0x74, 0x68, 0x7a, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x14, 0x61, 0x73, 0x65, 0x72, 0x74, 0x6f, 0x2e, 0x6d, 0x69, 0x64, 0x64, 0x6c,
+	0x65, 0x77, 0x61, 0x72, 0x65, 0x2e, 0x76, 0x31, 0x1a, 0x20, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69,
+	0x70, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x86, 0x01, 0x0a, 0x04, 0x52,
+	0x75, 0x6c, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x5f, 0x70, 0x61,
+	0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79,
+	0x50, 0x61, 0x74, 0x68, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x72, 0x65, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x66,
+	0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x72, 0x65, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x65,
+	0x78, 0x65, 0x6d, 0x70, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x65, 0x78, 0x65,
+	0x6d, 0x70, 0x74, 0x3a, 0x50, 0x0a, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x12, 0x1e, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x4d, 0x65,
+	0x74, 0x68, 0x6f, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x91, 0x90, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x61, 0x73, 0x65, 0x72, 0x74, 0x6f, 0x2e, 0x6d, 0x69, 0x64,
+	0x64, 0x6c, 0x65, 0x77, 0x61, 0x72, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x75, 0x6c, 0x65, 0x52,
+	0x04, 0x72, 0x75, 0x6c, 0x65, 0x42, 0x41, 0x5a, 0x3f, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x73, 0x65, 0x72, 0x74, 0x6f, 0x2d, 0x64, 0x65, 0x76, 0x2f, 0x61,
+	0x73, 0x65, 0x72, 0x74, 0x6f, 0x2d, 0x67, 0x6f, 0x2f, 0x6d, 0x69, 0x64, 0x64, 0x6c, 0x65, 0x77,
+	0x61, 0x72, 0x65, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x61, 0x75, 0x74, 0x68, 0x7a, 0x70, 0x62,
+	0x3b, 0x61, 0x75, 0x74, 0x68, 0x7a, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_aserto_middleware_v1_authz_proto_rawDescOnce sync.Once
+	file_aserto_middleware_v1_authz_proto_rawDescData = file_aserto_middleware_v1_authz_proto_rawDesc
+)
+
+func file_aserto_middleware_v1_authz_proto_rawDescGZIP() []byte {
+	file_aserto_middleware_v1_authz_proto_rawDescOnce.Do(func() {
+		file_aserto_middleware_v1_authz_proto_rawDescData = protoimpl.X.CompressGZIP(file_aserto_middleware_v1_authz_proto_rawDescData)
+	})
+	return file_aserto_middleware_v1_authz_proto_rawDescData
+}
+
+var file_aserto_middleware_v1_authz_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_aserto_middleware_v1_authz_proto_goTypes = []interface{}{
+	(*Rule)(nil),                       // 0: aserto.middleware.v1.Rule
+	(*descriptorpb.MethodOptions)(nil), // 1: google.protobuf.MethodOptions
+}
+var file_aserto_middleware_v1_authz_proto_depIdxs = []int32{
+	1, // 0: aserto.middleware.v1.rule:extendee -> google.protobuf.MethodOptions
+	0, // 1: aserto.middleware.v1.rule:type_name -> aserto.middleware.v1.Rule
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	1, // [1:2] is the sub-list for extension type_name
+	0, // [0:1] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_aserto_middleware_v1_authz_proto_init() }
+func file_aserto_middleware_v1_authz_proto_init() {
+	if File_aserto_middleware_v1_authz_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_aserto_middleware_v1_authz_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Rule); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_aserto_middleware_v1_authz_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_aserto_middleware_v1_authz_proto_goTypes,
+		DependencyIndexes: file_aserto_middleware_v1_authz_proto_depIdxs,
+		MessageInfos:      file_aserto_middleware_v1_authz_proto_msgTypes,
+		ExtensionInfos:    file_aserto_middleware_v1_authz_proto_extTypes,
+	}.Build()
+	File_aserto_middleware_v1_authz_proto = out.File
+	file_aserto_middleware_v1_authz_proto_rawDesc = nil
+	file_aserto_middleware_v1_authz_proto_goTypes = nil
+	file_aserto_middleware_v1_authz_proto_depIdxs = nil
+}
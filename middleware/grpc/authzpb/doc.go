@@ -0,0 +1,22 @@
+/*
+Package authzpb contains Go bindings for the protobuf options defined in "aserto/middleware/v1/authz.proto".
+
+The options let service authors declare authorization rules alongside their RPC definitions:
+
+  import "aserto/middleware/v1/authz.proto";
+
+  service ExampleService {
+    rpc GetItem(GetItemRequest) returns (Item) {
+      option (aserto.middleware.v1.rule) = {
+        policy_path: "example.GetItem"
+        decisions: ["allowed"]
+        resource_fields: ["id"]
+      };
+    }
+  }
+
+The gRPC middleware reads these options when configured using `Middleware.WithAnnotations()`.
+*/
+package authzpb
+
+//go:generate protoc -I ../../../proto --go_out=../../.. --go_opt=module=github.com/aserto-dev/aserto-go aserto/middleware/v1/authz.proto
@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+)
+
+// Connect returns a connect.Interceptor that authorizes incoming connect RPCs (including calls made using the gRPC and
+// gRPC-Web protocols) the same way Unary() and Stream() authorize gRPC calls.
+//
+// Request headers are exposed to the identity builder as incoming metadata and the procedure name (e.g.
+// "/example.ExampleService/Method") is used as the method name, so identity, policy and resource mappers, method
+// policies, annotations, and exemptions apply to both kinds of servers. Streaming handlers are authorized according to
+// `WithStreamAuthorization()`. Streams are always authorized before the handler runs. With `AuthorizeEachMessage`,
+// each received message is also authorized, denied messages fail the stream's Receive() method, and the handler's
+// context holds the result of the authorization made when the stream was opened. The interceptor doesn't affect
+// clients.
+//
+// Rejected calls fail with a *connect.Error that has the same code as the gRPC status the interceptors return,
+// including the details added by `WithDenialDetails()`.
+func (m *Middleware) Connect() connect.Interceptor {
+	return &connectInterceptor{m: m}
+}
+
+type connectInterceptor struct {
+	m *Middleware
+}
+
+func (i *connectInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+
+		ctx, err := i.authorize(ctx, req.Spec().Procedure, req.Header(), req.Any())
+		if err != nil {
+			return nil, err
+		}
+
+		return next(ctx, req)
+	}
+}
+
+func (i *connectInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *connectInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		method := conn.Spec().Procedure
+
+		authorized, err := i.authorize(ctx, method, conn.RequestHeader(), nil)
+		if err != nil {
+			return err
+		}
+
+		if i.m.streamAuth.mode(method) == AuthorizeEachMessage && !i.m.isExempt(method) {
+			return next(authorized, &authorizedConn{StreamingHandlerConn: conn, ctx: ctx, authorize: i.authorize})
+		}
+
+		return next(authorized, conn)
+	}
+}
+
+// authorize authorizes a call and returns ctx with the authorization result. Errors are converted to connect errors.
+func (i *connectInterceptor) authorize(
+	ctx context.Context,
+	method string,
+	header http.Header,
+	req interface{},
+) (context.Context, error) {
+	ctx, err := i.m.authorizeWithHeaders(ctx, method, header, req)
+	if err != nil {
+		return ctx, connectError(err)
+	}
+
+	return ctx, nil
+}
+
+// connectError converts an error returned by the gRPC interceptors to a *connect.Error with the same code, message,
+// and details.
+func connectError(err error) error {
+	st := status.Convert(err)
+	connectErr := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+
+	for _, detail := range st.Proto().GetDetails() {
+		if errDetail, err := connect.NewErrorDetail(detail); err == nil {
+			connectErr.AddDetail(errDetail)
+		}
+	}
+
+	return connectErr
+}
+
+// authorizedConn wraps a connect.StreamingHandlerConn and authorizes each message it receives.
+type authorizedConn struct {
+	connect.StreamingHandlerConn
+
+	ctx       context.Context
+	authorize func(context.Context, string, http.Header, interface{}) (context.Context, error)
+}
+
+func (c *authorizedConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+
+	_, err := c.authorize(c.ctx, c.Spec().Procedure, c.RequestHeader(), msg)
+
+	return err
+}
@@ -0,0 +1,135 @@
+package grpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/aserto-dev/aserto-go/middleware"
+	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const connectProcedure = "/example.ExampleService/Method"
+
+func connectCall(t *testing.T, mw *grpcmw.Middleware, handled *bool) error {
+	t.Helper()
+
+	handler := connect.NewUnaryHandler(
+		connectProcedure,
+		func(ctx context.Context, _ *connect.Request[api.PolicyContext]) (*connect.Response[api.PolicyContext], error) {
+			_, *handled = middleware.AuthorizationResultFromContext(ctx)
+			return connect.NewResponse(&api.PolicyContext{}), nil
+		},
+		connect.WithInterceptors(mw.Connect()),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(connectProcedure, handler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := connect.NewClient[api.PolicyContext, api.PolicyContext](server.Client(), server.URL+connectProcedure)
+
+	req := connect.NewRequest(&api.PolicyContext{Path: "products.get"})
+	req.Header().Set("Authorization", "Bearer "+test.DefaultUsername)
+
+	_, err := client.CallUnary(context.Background(), req)
+
+	return err
+}
+
+func TestConnect(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"path": "products.get"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("example.ExampleService.Method"), test.Resource(resource))
+
+	t.Run("allowed calls should reach the handler", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithResourceFromFields("path")
+
+		var handled bool
+
+		assert.NoError(t, connectCall(t, mw, &handled))
+		assert.True(t, handled)
+	})
+
+	t.Run("denied calls should fail with permission denied", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(false)), test.Policy("")).
+			WithResourceFromFields("path").
+			WithDenialDetails(middleware.DenialDetailsOptions{})
+
+		var handled bool
+
+		err := connectCall(t, mw, &handled)
+		assert.False(t, handled)
+
+		var connectErr *connect.Error
+		require.ErrorAs(t, err, &connectErr)
+		assert.Equal(t, connect.CodePermissionDenied, connectErr.Code())
+
+		require.Len(t, connectErr.Details(), 1)
+		detail, err := connectErr.Details()[0].Value()
+		require.NoError(t, err)
+
+		info, ok := detail.(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		assert.Equal(t, "example.ExampleService.Method", info.Metadata["policy_path"])
+	})
+}
+
+func TestConnectStreamAuthorization(t *testing.T) {
+	expected := test.Request(test.PolicyPath("example.ExampleService.Method"))
+
+	var (
+		outcomes []middleware.Outcome
+		handled  bool
+	)
+
+	mw := grpcmw.New(mock.New(t, expected, test.Decision(false)), test.Policy("")).
+		WithStreamAuthorization(grpcmw.AuthorizeEachMessage).
+		WithHook(func(_ context.Context, event *middleware.Event) {
+			outcomes = append(outcomes, event.Outcome)
+		})
+
+	// The handler responds without receiving any message.
+	handler := connect.NewClientStreamHandler(
+		connectProcedure,
+		func(
+			_ context.Context,
+			_ *connect.ClientStream[api.PolicyContext],
+		) (*connect.Response[api.PolicyContext], error) {
+			handled = true
+			return connect.NewResponse(&api.PolicyContext{}), nil
+		},
+		connect.WithInterceptors(mw.Connect()),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(connectProcedure, handler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := connect.NewClient[api.PolicyContext, api.PolicyContext](server.Client(), server.URL+connectProcedure)
+
+	stream := client.CallClientStream(context.Background())
+	stream.RequestHeader().Set("Authorization", "Bearer "+test.DefaultUsername)
+
+	_, err := stream.CloseAndReceive()
+
+	var connectErr *connect.Error
+	require.ErrorAs(t, err, &connectErr)
+	assert.Equal(t, connect.CodePermissionDenied, connectErr.Code())
+	assert.False(t, handled, "Handlers of unauthorized streams shouldn't run")
+	assert.Equal(t, []middleware.Outcome{middleware.OutcomeDenied}, outcomes)
+}
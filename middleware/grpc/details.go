@@ -0,0 +1,81 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-utils/cerr"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const deniedReason = "AUTHORIZATION_DENIED"
+
+/*
+WithDenialDetails instructs the middleware to include structured details in the status of denied calls.
+
+The status includes an `errdetails.ErrorInfo` with the evaluated policy path, the name of the decision that was
+denied, and the policy's reason if it has one. The ErrorInfo's domain is the aserto error code of
+`cerr.ErrAuthorizationFailed`, so clients can use `cerr.UnwrapAsertoError` to inspect the details.
+If options.IncludeOutputs is set, the values of all rules in the policy are included as a `structpb.Struct`.
+
+Use options.Redact to remove sensitive information before details are sent to callers.
+*/
+func (m *Middleware) WithDenialDetails(options middleware.DenialDetailsOptions) *Middleware {
+	m.denialDetails = &options
+	return m
+}
+
+// deniedError is returned from interceptors when a call is denied and the middleware is configured to include
+// denial details. It matches cerr.ErrAuthorizationFailed when compared using errors.Is.
+type deniedError struct {
+	status *status.Status
+}
+
+func (e *deniedError) Error() string {
+	return cerr.ErrAuthorizationFailed.Error()
+}
+
+func (e *deniedError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *deniedError) Is(target error) bool {
+	return target == cerr.ErrAuthorizationFailed
+}
+
+func (m *Middleware) deniedError(ctx context.Context, result *middleware.AuthorizationResult, decision string) error {
+	details := internal.NewDenialDetails(ctx, m.client, result, decision, m.denialDetails)
+
+	metadata := map[string]string{}
+	for key, value := range map[string]string{
+		"policy_path": details.PolicyPath,
+		"decision":    details.Decision,
+		"reason":      details.Reason,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+
+	st := cerr.ErrAuthorizationFailed.GRPCStatus()
+
+	withInfo, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   deniedReason,
+		Domain:   cerr.ErrAuthorizationFailed.Code,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return cerr.ErrAuthorizationFailed
+	}
+
+	if outputs, err := structpb.NewStruct(details.Outputs); err == nil && len(details.Outputs) > 0 {
+		if withOutputs, err := withInfo.WithDetails(outputs); err == nil {
+			withInfo = withOutputs
+		}
+	}
+
+	return &deniedError{status: withInfo}
+}
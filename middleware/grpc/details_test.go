@@ -0,0 +1,58 @@
+package grpc_test
+
+import (
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDenialDetails(t *testing.T) {
+	outputs, err := structpb.NewStruct(map[string]interface{}{
+		"outputs": map[string]interface{}{"allowed": true, "owner": false, "reason": "not an owner"},
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("example.delete"))
+	expected.PolicyContext.Decisions = []string{"allowed", "owner"}
+
+	client := mock.New(t, expected, decision("allowed", true), decision("owner", false))
+	client.QueryResponse = &authz.QueryResponse{Results: []*structpb.Struct{outputs}}
+
+	mw := grpcmw.New(client, test.Policy(DefaultPolicyPath)).
+		WithMethodPolicies(methodPolicies()...).
+		WithDenialDetails(middleware.DenialDetailsOptions{
+			IncludeOutputs: true,
+			Redact: func(details *middleware.DenialDetails) {
+				details.Outputs = nil
+			},
+		})
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	err = callMethod(mw, deleteMethod)
+	assert.ErrorIs(t, err, cerr.ErrAuthorizationFailed)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.PermissionDenied, st.Code())
+	require.Len(t, st.Details(), 1)
+
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, cerr.ErrAuthorizationFailed.Code, info.Domain)
+	assert.Equal(
+		t,
+		map[string]string{"policy_path": "example.delete", "decision": "owner", "reason": "not an owner"},
+		info.Metadata,
+	)
+}
@@ -0,0 +1,64 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var errTransportUnsupported = errors.New("grpc transport functions aren't supported outside grpc servers")
+
+// authorizeWithHeaders authorizes calls received by servers that aren't built with grpc-go. Request headers are
+// exposed to mappers as incoming metadata and the method name is returned by grpc.Method().
+//
+// It returns ctx with the authorization result, so the handler's context isn't tied to the grpc-go transport.
+func (m *Middleware) authorizeWithHeaders(
+	ctx context.Context,
+	method string,
+	header http.Header,
+	req interface{},
+) (context.Context, error) {
+	md := metadata.MD{}
+	for key, values := range header {
+		md.Append(key, values...)
+	}
+
+	callCtx := metadata.NewIncomingContext(ctx, md)
+	callCtx = grpc.NewContextWithServerTransportStream(callCtx, &methodTransportStream{method: method})
+
+	callCtx, err := m.authorize(callCtx, method, req)
+	if err != nil {
+		return ctx, err
+	}
+
+	if result, ok := middleware.AuthorizationResultFromContext(callCtx); ok {
+		ctx = middleware.ContextWithAuthorizationResult(ctx, result)
+	}
+
+	return ctx, nil
+}
+
+// methodTransportStream lets mappers call grpc.Method() to get the name of calls received by other servers.
+type methodTransportStream struct {
+	method string
+}
+
+func (s *methodTransportStream) Method() string {
+	return s.method
+}
+
+func (s *methodTransportStream) SetHeader(metadata.MD) error {
+	return errTransportUnsupported
+}
+
+func (s *methodTransportStream) SendHeader(metadata.MD) error {
+	return errTransportUnsupported
+}
+
+func (s *methodTransportStream) SetTrailer(metadata.MD) error {
+	return errTransportUnsupported
+}
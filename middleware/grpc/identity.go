@@ -2,21 +2,25 @@ package grpc
 
 import (
 	"context"
+	"crypto/x509"
 
 	"github.com/aserto-dev/aserto-go/middleware"
 	"github.com/aserto-dev/aserto-go/middleware/internal"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 // IdentityMapper is the type of callback functions that can inspect incoming RPCs and set the caller's identity.
 type IdentityMapper func(context.Context, interface{}, middleware.Identity)
 
+// IdentityMapperE is like IdentityMapper but can return an error if the caller's identity can't be determined.
+type IdentityMapperE func(context.Context, interface{}, middleware.Identity) error
+
 // IdentityBuilder is used to configure what information about caller identity is sent in authorization calls.
 type IdentityBuilder struct {
-	identityType    api.IdentityType
-	defaultIdentity string
-	mapper          IdentityMapper
+	builder internal.IdentityBuilder[interface{}]
 }
 
 // Static values
@@ -28,7 +32,7 @@ type IdentityBuilder struct {
 //
 //  idBuilder.JWT().FromHeader("Authorization")
 func (b *IdentityBuilder) JWT() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_JWT
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_JWT)
 	return b
 }
 
@@ -39,61 +43,150 @@ func (b *IdentityBuilder) JWT() *IdentityBuilder {
 //
 //  idBuilder.Subject().FromContextValue("username")
 func (b *IdentityBuilder) Subject() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_SUB
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_SUB)
 	return b
 }
 
 // Call None() to indicate that requests are unauthenticated.
 func (b *IdentityBuilder) None() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_NONE
-	b.defaultIdentity = ""
-
+	b.builder.None()
 	return b
 }
 
-// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, IdentityMapper
-// tries to infer whether the specified identity is a JWT or not.
+// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, the identity type
+// is inferred from the identity: values that parse as JWTs are sent as JWTs and other values as subjects.
 // Passing an empty string is the same as calling .None() and results in an authorization check for anonymous access.
 func (b *IdentityBuilder) ID(identity string) *IdentityBuilder {
-	b.defaultIdentity = identity
+	b.builder.SetID(identity)
 	return b
 }
 
 // FromMetadata extracts caller identity from a grpc/metadata field in the incoming message.
+//
+// The "Bearer" authentication scheme is removed from the value of the "authorization" field.
 func (b *IdentityBuilder) FromMetadata(field string) *IdentityBuilder {
-	b.mapper = func(ctx context.Context, _ interface{}, identity middleware.Identity) {
+	return b.Mapper(func(ctx context.Context, _ interface{}, identity middleware.Identity) {
 		if md, ok := metadata.FromIncomingContext(ctx); ok {
 			id := md.Get(field)
 			if len(id) > 0 {
-				identity.ID(id[0])
+				identity.ID(internal.IdentityValue(field, id[0]))
 			}
 		}
-	}
-
-	return b
+	})
 }
 
 // WithIdentityFromContextValue extracts caller identity from a context value in the incoming message.
 func (b *IdentityBuilder) FromContextValue(key interface{}) *IdentityBuilder {
-	b.mapper = func(ctx context.Context, _ interface{}, identity middleware.Identity) {
+	return b.Mapper(func(ctx context.Context, _ interface{}, identity middleware.Identity) {
 		identity.ID(internal.ValueOrEmpty(ctx, key))
+	})
+}
+
+// FromPeerCertificate extracts caller identity from the client certificate of RPCs received over mutual TLS.
+// The selector determines which certificate field identifies the caller. For example:
+//
+//  idBuilder.FromPeerCertificate(middleware.SPIFFEID)
+//
+// The identity type is set to subject. If the caller didn't present a certificate or the selected field is empty, the
+// call is considered anonymous.
+func (b *IdentityBuilder) FromPeerCertificate(selector middleware.CertificateSelector) *IdentityBuilder {
+	return b.Mapper(func(ctx context.Context, _ interface{}, identity middleware.Identity) {
+		certs := peerCertificates(ctx)
+		if len(certs) == 0 {
+			identity.None()
+			return
+		}
+
+		identity.Subject().ID(selector(certs[0]))
+	})
+}
+
+// FirstOf retrieves caller identity from an ordered list of sources. Each source is an IdentityBuilder with its own
+// identity type and source. The first source that yields an identity is used.
+// If none of the sources yield an identity, the call is considered anonymous.
+//
+// For example, to read a JWT from the "authorization" metadata field or, if it's missing, the client certificate:
+//
+//  idBuilder.FirstOf(
+//    (&IdentityBuilder{}).JWT().FromMetadata("authorization"),
+//    (&IdentityBuilder{}).FromPeerCertificate(middleware.CommonName),
+//  )
+//
+// Sources that don't have an identity type use the type of the builder that FirstOf is called on.
+// Each source is verified and transformed with its own settings. The verifier of the builder that FirstOf is called on
+// only applies to tokens from sources that don't have one, and its transforms apply to subjects from any source.
+func (b *IdentityBuilder) FirstOf(sources ...*IdentityBuilder) *IdentityBuilder {
+	builders := make([]*internal.IdentityBuilder[interface{}], len(sources))
+	for i, source := range sources {
+		builders[i] = &source.builder
 	}
 
+	b.builder.SetSources(builders...)
+
+	return b
+}
+
+// Transform adds functions that post-process the caller's identity before it is sent to the authorizer.
+// Transforms are applied in order, after JWT verification and subject extraction. They only apply to subject
+// identities; JWTs are sent unchanged. For example:
+//
+//  idBuilder.Subject().FromMetadata("x-user-email").Transform(middleware.Lowercase)
+func (b *IdentityBuilder) Transform(transforms ...middleware.IdentityTransform) *IdentityBuilder {
+	b.builder.AddTransforms(transforms...)
 	return b
 }
 
 // Mapper takes a custom IdentityMapper to be used for extracting identity information from incomign RPCs.
 func (b *IdentityBuilder) Mapper(mapper IdentityMapper) *IdentityBuilder {
-	b.mapper = mapper
+	return b.MapperE(func(ctx context.Context, req interface{}, identity middleware.Identity) error {
+		mapper(ctx, req, identity)
+		return nil
+	})
+}
+
+// MapperE takes a custom IdentityMapperE to be used for extracting identity information from incoming RPCs.
+// If the mapper returns an error, the middleware rejects the call according to its `WithMappingFailure()` setting.
+func (b *IdentityBuilder) MapperE(mapper IdentityMapperE) *IdentityBuilder {
+	b.builder.SetMapper(func(ctx context.Context, req interface{}, identity middleware.Identity) error {
+		return mapper(ctx, req, identity)
+	})
+
+	return b
+}
+
+// VerifyJWT instructs the builder to verify caller JWTs using the specified verifier.
+// Calls with invalid tokens are rejected with status UNAUTHENTICATED before the authorizer is called.
+//
+// If the identity type is subject, the verified token's subject is sent to the authorizer instead of the token:
+//
+//  idBuilder.Subject().FromMetadata("authorization").VerifyJWT(verifier)
+//
+// Otherwise, the token is sent as a JWT identity.
+func (b *IdentityBuilder) VerifyJWT(verifier *middleware.JWTVerifier) *IdentityBuilder {
+	b.builder.SetVerifier(verifier)
 	return b
 }
 
 func (b *IdentityBuilder) build(ctx context.Context, req interface{}) *api.IdentityContext {
-	identity := internal.NewIdentity(b.identityType, b.defaultIdentity)
+	return b.builder.Build(ctx, req)
+}
+
+// resolve returns the caller's identity. If JWT verification is enabled, an error wrapping
+// middleware.ErrUnauthenticated is returned for invalid tokens.
+func (b *IdentityBuilder) resolve(ctx context.Context, req interface{}) (*api.IdentityContext, error) {
+	return b.builder.Resolve(ctx, req)
+}
+
+func peerCertificates(ctx context.Context) []*x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
 
-	if b.mapper != nil {
-		b.mapper(ctx, req, identity)
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
 	}
 
-	return identity.Context()
+	return tlsInfo.State.PeerCertificates
 }
@@ -2,10 +2,18 @@ package grpc // nolint:testpackage // Testing unexported method .build()
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
 	"testing"
 
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
 	"github.com/aserto-dev/aserto-go/middleware"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
@@ -140,3 +148,125 @@ func TestIdentityMapper(t *testing.T) {
 		id.Subject().ID("goerge")
 	})
 }
+
+func TestIdentityFromPeerCertificate(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: username},
+		EmailAddresses: []string{"george@example.com"},
+		URIs: []*url.URL{
+			{Scheme: "https", Host: "example.com", Path: "/george"},
+			{Scheme: "spiffe", Host: "example.org", Path: "/ns/default/sa/george"},
+		},
+	}
+
+	ctx := peer.NewContext(context.TODO(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+
+	tests := []struct {
+		name     string
+		selector middleware.CertificateSelector
+		expected string
+	}{
+		{"common name", middleware.CommonName, username},
+		{"email", middleware.EmailSAN, "george@example.com"},
+		{"uri", middleware.URISAN, "https://example.com/george"},
+		{"spiffe id", middleware.SPIFFEID, "spiffe://example.org/ns/default/sa/george"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(
+				t,
+				&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: test.expected},
+				(&IdentityBuilder{}).FromPeerCertificate(test.selector).build(ctx, nil),
+			)
+		})
+	}
+}
+
+func TestIdentityFromMissingPeerCertificate(t *testing.T) {
+	builder := (&IdentityBuilder{}).ID(username).FromPeerCertificate(middleware.CommonName)
+
+	assert.Equal(
+		t,
+		Anon(),
+		builder.build(context.TODO(), nil),
+		"Calls without client certificates should be anonymous",
+	)
+}
+
+func TestSubjectFromBearerMetadata(t *testing.T) {
+	token := jwt.New()
+	assert.NoError(t, token.Set(jwt.SubjectKey, username))
+
+	signed, err := jwt.Sign(token, jwa.HS256, []byte("secret"))
+	assert.NoError(t, err)
+
+	md := metadata.New(map[string]string{"authorization": "Bearer " + string(signed)})
+	ctx := metadata.NewIncomingContext(context.TODO(), md)
+
+	assert.Equal(
+		t,
+		SUB(),
+		(&IdentityBuilder{}).Subject().FromMetadata("authorization").build(ctx, nil),
+		"Subject should be read from bearer token",
+	)
+
+	assert.Equal(
+		t,
+		&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_JWT, Identity: string(signed)},
+		(&IdentityBuilder{}).FromMetadata("authorization").build(ctx, nil),
+		"Untyped bearer tokens should be sent as JWTs",
+	)
+}
+
+func TestIdentityFirstOf(t *testing.T) {
+	builder := (&IdentityBuilder{}).FirstOf(
+		(&IdentityBuilder{}).JWT().FromMetadata("authorization"),
+		(&IdentityBuilder{}).Subject().FromContextValue(user{}),
+	)
+
+	md := metadata.New(map[string]string{"authorization": username})
+	ctx := context.WithValue(context.TODO(), user{}, username)
+
+	assert.Equal(
+		t,
+		JWT(),
+		builder.build(metadata.NewIncomingContext(ctx, md), nil),
+		"First source with a value should be used",
+	)
+
+	assert.Equal(
+		t,
+		SUB(),
+		builder.build(ctx, nil),
+		"Missing sources should fall back to the next one",
+	)
+
+	assert.Equal(
+		t,
+		Anon(),
+		builder.build(context.TODO(), nil),
+		"Identity should be anonymous if no source has a value",
+	)
+}
+
+func TestIdentityTransform(t *testing.T) {
+	builder := (&IdentityBuilder{}).Subject().FromContextValue(user{}).
+		Transform(middleware.TrimPrefix("user:"), middleware.Lowercase)
+
+	assert.Equal(
+		t,
+		SUB(),
+		builder.build(context.WithValue(context.TODO(), user{}, "user:George"), nil),
+		"Transforms should be applied in order",
+	)
+
+	assert.Equal(
+		t,
+		Anon(),
+		builder.build(context.WithValue(context.TODO(), user{}, "user:"), nil),
+		"Empty transformed identities should be anonymous",
+	)
+}
@@ -9,10 +9,12 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/aserto-dev/aserto-go/middleware"
-	"github.com/aserto-dev/aserto-go/middleware/grpc/internal/pbutil"
 	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/aserto-go/middleware/internal/pbutil"
 	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
 	"github.com/aserto-dev/go-utils/cerr"
@@ -47,7 +49,16 @@ type Middleware struct {
 	client          AuthorizerClient
 	policy          api.PolicyContext
 	policyMapper    StringMapper
-	resourceMappers []ResourceMapper
+	resourceMappers []ResourceMapperE
+	resourceFields  []fieldSelection
+	mappingFailure  middleware.MappingFailure
+	streamAuth      streamAuthorization
+	exemptMethods   []string
+	methodPolicies  []MethodPolicy
+	annotations     *AnnotationResolver
+	denialDetails   *middleware.DenialDetailsOptions
+	denyByDefault   bool
+	hooks           internal.Hooks
 }
 
 type (
@@ -57,6 +68,9 @@ type (
 
 	// ResourceMapper functions are used to extract structured data from incoming message.
 	ResourceMapper func(context.Context, interface{}, map[string]interface{})
+
+	// ResourceMapperE is like ResourceMapper but can return an error if the resource can't be determined.
+	ResourceMapperE func(context.Context, interface{}, map[string]interface{}) error
 )
 
 // New creates middleware for the specified policy.
@@ -75,7 +89,8 @@ func New(client AuthorizerClient, policy Policy) *Middleware {
 		Identity:        (&IdentityBuilder{}).FromMetadata("authorization"),
 		policy:          *internal.DefaultPolicyContext(policy),
 		policyMapper:    policyMapper,
-		resourceMappers: []ResourceMapper{},
+		resourceMappers: []ResourceMapperE{},
+		streamAuth:      streamAuthorization{byMethod: map[string]StreamAuthorization{}},
 	}
 }
 
@@ -90,7 +105,10 @@ func (m *Middleware) WithPolicyPathMapper(mapper StringMapper) *Middleware {
 WithResourceFromFields instructs the middleware to select the specified fields from incoming messages and
 use them as the resource in authorization calls. Fields are expressed as a field mask.
 
-Note: Protobuf message fields are identified using their JSON names.
+Note: Protobuf message fields are identified using their JSON names or their names in the .proto file.
+Elements of repeated fields and values of map fields are selected with the "*" wildcard (e.g. "items.*.id"),
+a single map entry is selected using its key (e.g. "labels.env"), and naming a oneof selects whichever of its
+fields is set.
 
 Example:
 
@@ -106,10 +124,12 @@ This call would result in an authorization resource with the following structure
   }
 
 If the value of "address" is itself a message, all of its fields are included.
+
+Calls with messages that don't have the selected fields fail with the error set using `WithMappingFailure()`.
+`Validate()` checks the fields against the request messages of all registered methods.
 */
 func (m *Middleware) WithResourceFromFields(fields ...string) *Middleware {
-	m.resourceMappers = append(m.resourceMappers, messageResourceMapper(map[string][]string{}, fields...))
-	return m
+	return m.withFieldSelection(fieldSelection{defaults: fields})
 }
 
 /*
@@ -139,8 +159,7 @@ For all other methods, the middleware constructs in a authorization resource wit
   }
 */
 func (m *Middleware) WithResourceFromMessageByPath(fieldsByPath map[string][]string, defaults ...string) *Middleware {
-	m.resourceMappers = append(m.resourceMappers, messageResourceMapper(fieldsByPath, defaults...))
-	return m
+	return m.withFieldSelection(fieldSelection{byMethod: fieldsByPath, defaults: defaults})
 }
 
 /*
@@ -155,17 +174,65 @@ In each incoming request, the middlware reads the value of the "account_id" key
 adds its value to the "account" field in the authorization resource context.
 */
 func (m *Middleware) WithResourceFromContextValue(ctxKey interface{}, field string) *Middleware {
-	m.resourceMappers = append(m.resourceMappers, contextValueResourceMapper(ctxKey, field))
-	return m
+	return m.WithResourceMapper(contextValueResourceMapper(ctxKey, field))
 }
 
 // WithResourceMapper takes a custom StructMapper for extracting the authorization resource context from
 // incoming messages.
 func (m *Middleware) WithResourceMapper(mapper ResourceMapper) *Middleware {
+	return m.WithResourceMapperE(func(ctx context.Context, req interface{}, res map[string]interface{}) error {
+		mapper(ctx, req, res)
+		return nil
+	})
+}
+
+// WithResourceMapperE takes a custom ResourceMapperE for extracting the authorization resource context from
+// incoming messages. If the mapper returns an error, the call is rejected according to the `WithMappingFailure()`
+// setting.
+func (m *Middleware) WithResourceMapperE(mapper ResourceMapperE) *Middleware {
 	m.resourceMappers = append(m.resourceMappers, mapper)
 	return m
 }
 
+// WithMappingFailure sets how the middleware responds to calls for which a resource or identity mapper returns an
+// error. The default is `middleware.MappingFailureError`, which fails calls with status INTERNAL.
+func (m *Middleware) WithMappingFailure(failure middleware.MappingFailure) *Middleware {
+	m.mappingFailure = failure
+	return m
+}
+
+// WithExemptMethods instructs the middleware to pass calls to the specified methods on to their handlers without
+// authorizing them. This is useful for health checks, server reflection, and other calls that don't require
+// authorization.
+//
+// Methods can be specified using their full name (e.g. "/example.ExampleService/Method"), a service prefix that ends
+// with a slash (e.g. "/grpc.health.v1.Health/"), or a glob pattern where '*' matches any sequence of characters
+// within the service or method name (e.g. "/grpc.reflection.*/*").
+//
+// Exempt calls are still reported to hooks with the outcome `middleware.OutcomeExempt`.
+func (m *Middleware) WithExemptMethods(patterns ...string) *Middleware {
+	m.exemptMethods = append(m.exemptMethods, patterns...)
+	return m
+}
+
+// WithDenyByDefault instructs the middleware to reject calls that have no explicit policy without sending them to the
+// authorizer. A call has an explicit policy if its method matches a policy set with `WithMethodPolicies()` or has an
+// annotation read by `WithAnnotations()`, and the resulting policy path isn't empty. The middleware's policy and
+// policy mapper only supply paths for such calls. Exempt methods are never rejected.
+//
+// The HTTP middleware applies the same rule to routes set with `WithRoutePolicy()`.
+func (m *Middleware) WithDenyByDefault() *Middleware {
+	m.denyByDefault = true
+	return m
+}
+
+// WithHook adds a function to be called with the outcome of each call handled by the middleware.
+// Hooks can be used to collect metrics or write audit logs.
+func (m *Middleware) WithHook(hook middleware.Hook) *Middleware {
+	m.hooks = append(m.hooks, hook)
+	return m
+}
+
 // Unary returns a grpc.UnaryServiceInterceptor that authorizes incoming messages.
 func (m *Middleware) Unary() grpc.UnaryServerInterceptor {
 	return func(
@@ -174,7 +241,8 @@ func (m *Middleware) Unary() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		if err := m.authorize(ctx, req); err != nil {
+		ctx, err := m.authorize(ctx, info.FullMethod, req)
+		if err != nil {
 			return nil, err
 		}
 
@@ -190,56 +258,143 @@ func (m *Middleware) Stream() grpc.StreamServerInterceptor {
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
 	) error {
-		ctx := stream.Context()
-
-		if err := m.authorize(ctx, nil); err != nil {
+		ctx, err := m.authorize(stream.Context(), info.FullMethod, nil)
+		if err != nil {
 			return err
 		}
 
-		return handler(srv, stream)
+		if m.streamAuth.mode(info.FullMethod) == AuthorizeEachMessage && !m.isExempt(info.FullMethod) {
+			return handler(srv, &authorizedStream{
+				ServerStream: stream,
+				ctx:          ctx,
+				method:       info.FullMethod,
+				authorize:    m.authorize,
+			})
+		}
+
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authorize checks whether a call to the specified method is allowed and reports the outcome to hooks.
+func (m *Middleware) authorize(ctx context.Context, method string, req interface{}) (context.Context, error) {
+	start := time.Now()
+	event := &middleware.Event{Operation: method, Outcome: middleware.OutcomeExempt}
+
+	defer m.hooks.Report(ctx, event, start)
+
+	if m.isExempt(method) {
+		return ctx, nil
+	}
+
+	result, err := m.is(ctx, method, req, event)
+
+	switch {
+	case err == nil:
+		event.Outcome = middleware.OutcomeAllowed
+	case internal.IsMapperError(err):
+		event.Outcome = internal.MappingOutcome(m.mappingFailure)
+		event.Err = err
+		err = internal.MappingGRPCError(m.mappingFailure, err)
+	case errors.Is(err, cerr.ErrAuthorizationFailed):
+		event.Outcome = middleware.OutcomeDenied
+	case errors.Is(err, middleware.ErrUnauthenticated):
+		event.Outcome = middleware.OutcomeUnauthenticated
+		event.Err = err
+		err = middleware.ErrUnauthenticated
+	default:
+		event.Outcome = middleware.OutcomeError
+		event.Err = err
+	}
+
+	if err != nil {
+		return ctx, err
 	}
+
+	return middleware.ContextWithAuthorizationResult(ctx, result), nil
 }
 
-func (m *Middleware) authorize(ctx context.Context, req interface{}) error {
-	if m.policyMapper != nil {
-		m.policy.Path = m.policyMapper(ctx, req)
+func (m *Middleware) is(
+	ctx context.Context,
+	method string,
+	req interface{},
+	event *middleware.Event,
+) (*middleware.AuthorizationResult, error) {
+	policy := m.policyContext(ctx, method, req)
+	if policy == nil || (policy.Path == "" && m.denyByDefault) {
+		return nil, cerr.ErrAuthorizationFailed
 	}
 
-	resource, err := m.resourceContext(ctx, req)
+	event.PolicyPath = policy.Path
+
+	resource, err := m.resourceContext(ctx, method, req)
 	if err != nil {
-		return errors.Wrap(err, "failed to apply resource mapper")
+		return nil, err
 	}
 
-	resp, err := m.client.Is(
-		ctx,
-		&authz.IsRequest{
-			IdentityContext: m.Identity.build(ctx, req),
-			PolicyContext:   &m.policy,
-			ResourceContext: resource,
-		},
-	)
+	identity, err := m.Identity.resolve(ctx, req)
 	if err != nil {
-		return errors.Wrap(err, "authorization call failed")
+		return nil, err
 	}
 
-	if len(resp.Decisions) == 0 {
-		return cerr.ErrInvalidDecision
+	result, err := internal.Is(ctx, m.client, &authz.IsRequest{
+		IdentityContext: identity,
+		PolicyContext:   policy,
+		ResourceContext: resource,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "authorization call failed")
 	}
 
-	if !resp.Decisions[0].Is {
-		return cerr.ErrAuthorizationFailed
+	decision, err := checkDecisions(policy.Decisions, result.Decisions)
+	if errors.Is(err, cerr.ErrAuthorizationFailed) && m.denialDetails != nil {
+		return nil, m.deniedError(ctx, result, decision)
 	}
 
-	return nil
+	return result, err
 }
 
-func (m *Middleware) resourceContext(ctx context.Context, req interface{}) (*structpb.Struct, error) {
+func (m *Middleware) isExempt(method string) bool {
+	for _, pattern := range m.exemptMethods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+
+	if rule := m.annotatedRule(method); rule != nil && rule.Exempt {
+		if _, ok := m.methodPolicy(method); !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Middleware) resourceContext(ctx context.Context, method string, req interface{}) (*structpb.Struct, error) {
 	res := map[string]interface{}{}
 	for _, mapper := range m.resourceMappers {
-		mapper(ctx, req, res)
+		if err := mapper(ctx, req, res); err != nil {
+			return nil, internal.MapperFailed(err)
+		}
 	}
 
-	return structpb.NewStruct(res)
+	if rule := m.annotatedRule(method); rule != nil && len(rule.ResourceFields) > 0 {
+		if err := selectFields(req, rule.ResourceFields, res); err != nil {
+			return nil, internal.MapperFailed(err)
+		}
+	}
+
+	resource, err := structpb.NewStruct(res)
+	if err != nil {
+		return nil, internal.MapperFailed(err)
+	}
+
+	return resource, nil
+}
+
+func (m *Middleware) withFieldSelection(selection fieldSelection) *Middleware {
+	m.resourceFields = append(m.resourceFields, selection)
+	return m.WithResourceMapperE(messageResourceMapper(selection))
 }
 
 func methodPolicyMapper(policyRoot string) StringMapper {
@@ -255,22 +410,57 @@ func methodPolicyMapper(policyRoot string) StringMapper {
 	}
 }
 
-func messageResourceMapper(fieldsByPath map[string][]string, defaults ...string) ResourceMapper {
-	return func(ctx context.Context, req interface{}, res map[string]interface{}) {
+// fieldSelection holds the message fields selected using WithResourceFromFields or WithResourceFromMessageByPath.
+type fieldSelection struct {
+	byMethod map[string][]string
+	defaults []string
+}
+
+// fields returns the fields selected from request messages of the specified method.
+func (s fieldSelection) fields(method string) []string {
+	if fields, ok := s.byMethod[method]; ok && len(fields) > 0 {
+		return fields
+	}
+
+	return s.defaults
+}
+
+// methods returns the sorted names of methods that have their own set of fields.
+func (s fieldSelection) methods() []string {
+	methods := make([]string, 0, len(s.byMethod))
+	for method := range s.byMethod {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
+func messageResourceMapper(selection fieldSelection) ResourceMapperE {
+	return func(ctx context.Context, req interface{}, res map[string]interface{}) error {
 		method, _ := grpc.Method(ctx)
+		return selectFields(req, selection.fields(method), res)
+	}
+}
 
-		fields, ok := fieldsByPath[method]
-		if !ok || len(fields) == 0 {
-			fields = defaults
-		}
+func selectFields(req interface{}, fields []string, res map[string]interface{}) error {
+	msg, ok := req.(protoreflect.ProtoMessage)
+	if !ok || len(fields) == 0 {
+		// Streams authorized once per call don't have a message to select from.
+		return nil
+	}
 
-		if len(fields) > 0 {
-			resource, _ := pbutil.Select(req.(protoreflect.ProtoMessage), fields...)
-			for k, v := range resource.AsMap() {
-				res[k] = v
-			}
-		}
+	resource, err := pbutil.Select(msg, fields...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to select fields from %s", msg.ProtoReflect().Descriptor().FullName())
 	}
+
+	for k, v := range resource.AsMap() {
+		res[k] = v
+	}
+
+	return nil
 }
 
 func contextValueResourceMapper(ctxKey interface{}, field string) ResourceMapper {
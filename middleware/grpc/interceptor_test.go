@@ -2,15 +2,24 @@ package grpc_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"testing"
 
+	"github.com/aserto-dev/aserto-go/middleware"
 	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
 	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
 	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
 	"github.com/aserto-dev/go-utils/cerr"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type TestCase struct {
@@ -25,7 +34,10 @@ type testOptions struct {
 	callback    func(*grpcmw.Middleware)
 }
 
-const DefaultPolicyPath = "policy.path"
+const (
+	DefaultPolicyPath = "policy.path"
+	streamMethod      = "/example.ExampleService/Stream"
+)
 
 func NewTest(t *testing.T, name string, options *testOptions) *TestCase {
 	if options.ExpectedRequest == nil && options.PolicyPath == "" {
@@ -130,3 +142,342 @@ func runStream(mw *grpcmw.Middleware) error {
 		},
 	)
 }
+
+func TestStreamAuthorization(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"identity": test.DefaultUsername})
+	assert.NoError(t, err)
+
+	opened := test.Request(test.PolicyPath(DefaultPolicyPath))
+	received := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(resource))
+	message := &api.IdentityContext{Identity: test.DefaultUsername}
+
+	tests := []struct {
+		name        string
+		client      *mock.Authorizer
+		methods     []string
+		expectedErr error
+		outcomes    []middleware.Outcome
+	}{
+		{
+			"authorized messages should be received",
+			mock.New(t, opened, test.Decision(true)).Then(received, test.Decision(true)),
+			nil,
+			nil,
+			[]middleware.Outcome{middleware.OutcomeAllowed, middleware.OutcomeAllowed},
+		},
+		{
+			"unauthorized messages should err",
+			mock.New(t, opened, test.Decision(true)).Then(received, test.Decision(false)),
+			[]string{streamMethod},
+			cerr.ErrAuthorizationFailed,
+			[]middleware.Outcome{middleware.OutcomeAllowed, middleware.OutcomeDenied},
+		},
+		{
+			"unauthorized streams should err before any message is received",
+			mock.New(t, opened, test.Decision(false)),
+			[]string{streamMethod},
+			cerr.ErrAuthorizationFailed,
+			[]middleware.Outcome{middleware.OutcomeDenied},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var outcomes []middleware.Outcome
+
+			mw := grpcmw.New(tc.client, test.Policy(DefaultPolicyPath)).
+				WithStreamAuthorization(grpcmw.AuthorizeEachMessage, tc.methods...).
+				WithResourceFromFields("identity").
+				WithHook(func(_ context.Context, event *middleware.Event) {
+					outcomes = append(outcomes, event.Outcome)
+				})
+			mw.Identity.Subject().ID(test.DefaultUsername)
+
+			err := recvStream(message)(mw)
+			if tc.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			}
+
+			assert.Equal(t, tc.outcomes, outcomes)
+		})
+	}
+}
+
+func TestStreamAuthorizationBeforeReceive(t *testing.T) {
+	var outcomes []middleware.Outcome
+
+	mw := grpcmw.New(
+		mock.New(t, test.Request(test.PolicyPath(DefaultPolicyPath)), test.Decision(false)),
+		test.Policy(DefaultPolicyPath),
+	).
+		WithStreamAuthorization(grpcmw.AuthorizeEachMessage).
+		WithHook(func(_ context.Context, event *middleware.Event) {
+			outcomes = append(outcomes, event.Outcome)
+		})
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	sent := false
+
+	err := mw.Stream()(
+		nil,
+		&mock.ServerStream{Ctx: context.Background()},
+		&grpc.StreamServerInfo{FullMethod: streamMethod},
+		func(_ interface{}, stream grpc.ServerStream) error {
+			sent = true
+			return stream.SendMsg(&api.IdentityContext{})
+		},
+	)
+
+	assert.ErrorIs(t, err, cerr.ErrAuthorizationFailed)
+	assert.False(t, sent, "Handlers of unauthorized streams shouldn't send messages")
+	assert.Equal(t, []middleware.Outcome{middleware.OutcomeDenied}, outcomes)
+}
+
+func recvStream(messages ...proto.Message) testRunner {
+	return func(mw *grpcmw.Middleware) error {
+		return mw.Stream()(
+			nil,
+			&mock.ServerStream{Ctx: context.Background(), Messages: messages},
+			&grpc.StreamServerInfo{FullMethod: streamMethod},
+			func(_ interface{}, stream grpc.ServerStream) error {
+				for {
+					msg := &api.IdentityContext{}
+					if err := stream.RecvMsg(msg); err != nil {
+						if errors.Is(err, io.EOF) {
+							return nil
+						}
+
+						return err
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestExemptMethods(t *testing.T) {
+	var outcomes []middleware.Outcome
+
+	mw := grpcmw.New(mock.New(t, nil, test.Decision(false)), test.Policy(DefaultPolicyPath)).
+		WithExemptMethods("/grpc.health.v1.Health/", "/grpc.reflection.*/*").
+		WithHook(func(_ context.Context, event *middleware.Event) {
+			outcomes = append(outcomes, event.Outcome)
+		})
+
+	for _, method := range []string{
+		"/grpc.health.v1.Health/Check",
+		"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+	} {
+		_, err := mw.Unary()(
+			context.Background(),
+			nil,
+			&grpc.UnaryServerInfo{FullMethod: method},
+			func(_ context.Context, _ interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []middleware.Outcome{middleware.OutcomeExempt, middleware.OutcomeExempt}, outcomes)
+}
+
+func TestDenyByDefault(t *testing.T) {
+	var event *middleware.Event
+
+	mw := grpcmw.New(mock.New(t, nil, test.Decision(true)), test.Policy("")).
+		WithPolicyPathMapper(func(context.Context, interface{}) string { return "" }).
+		WithDenyByDefault().
+		WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+
+	assert.ErrorIs(t, runUnary(mw), cerr.ErrAuthorizationFailed)
+	assert.Equal(t, middleware.OutcomeDenied, event.Outcome)
+}
+
+func TestAuthorizationResult(t *testing.T) {
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath))
+
+	assertResult := func(ctx context.Context, t *testing.T) {
+		result, ok := middleware.AuthorizationResultFromContext(ctx)
+		if assert.True(t, ok) {
+			assert.Equal(t, expected.IdentityContext, result.Identity)
+			assert.Equal(t, DefaultPolicyPath, result.Policy.Path)
+
+			is, ok := result.Decision(test.DefaultDecision)
+			assert.True(t, ok)
+			assert.True(t, is)
+		}
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		_, err := mw.Unary()(
+			context.Background(),
+			nil,
+			&grpc.UnaryServerInfo{},
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				assertResult(ctx, t)
+				return nil, nil
+			},
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		err := mw.Stream()(
+			nil,
+			&mock.ServerStream{Ctx: context.Background()},
+			&grpc.StreamServerInfo{},
+			func(_ interface{}, stream grpc.ServerStream) error {
+				assertResult(stream.Context(), t)
+				return nil
+			},
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, nil), test.Policy(DefaultPolicyPath)).WithExemptMethods(streamMethod)
+
+		_, err := mw.Unary()(
+			context.Background(),
+			nil,
+			&grpc.UnaryServerInfo{FullMethod: streamMethod},
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				_, ok := middleware.AuthorizationResultFromContext(ctx)
+				assert.False(t, ok)
+
+				return nil, nil
+			},
+		)
+		assert.NoError(t, err)
+	})
+}
+
+func TestVerifyJWT(t *testing.T) {
+	jwks := test.NewJWKS(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := middleware.NewJWKSVerifier(ctx, jwks.URL, middleware.JWTVerifierOptions{Issuer: test.Issuer})
+	assert.NoError(t, err)
+
+	callWithToken := func(mw *grpcmw.Middleware, token string) error {
+		_, err := mw.Unary()(
+			metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", token)),
+			nil,
+			&grpc.UnaryServerInfo{},
+			func(_ context.Context, _ interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		)
+
+		return err
+	}
+
+	t.Run("valid tokens should be sent as JWTs", func(t *testing.T) {
+		token := jwks.Token(t, nil)
+		expected := test.Request(
+			test.PolicyPath(DefaultPolicyPath),
+			test.IdentityType(api.IdentityType_IDENTITY_TYPE_JWT),
+			test.Identity(token),
+		)
+
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+		mw.Identity.FromMetadata("authorization").VerifyJWT(verifier)
+
+		assert.NoError(t, callWithToken(mw, token))
+	})
+
+	t.Run("invalid tokens should be unauthenticated", func(t *testing.T) {
+		var event *middleware.Event
+
+		mw := grpcmw.New(mock.New(t, nil), test.Policy(DefaultPolicyPath)).
+			WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+		mw.Identity.Subject().FromMetadata("authorization").VerifyJWT(verifier)
+
+		err := callWithToken(mw, jwks.Token(t, map[string]interface{}{"iss": "https://other.example.com"}))
+		assert.ErrorIs(t, err, middleware.ErrUnauthenticated)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, middleware.OutcomeUnauthenticated, event.Outcome)
+	})
+}
+
+func TestMappingFailure(t *testing.T) {
+	errMapper := errors.New("mapper error")
+
+	call := func(mw *grpcmw.Middleware) error {
+		_, err := mw.Unary()(
+			context.Background(),
+			&api.IdentityContext{Identity: test.DefaultUsername},
+			&grpc.UnaryServerInfo{},
+			func(_ context.Context, _ interface{}) (interface{}, error) {
+				return nil, nil
+			},
+		)
+
+		return err
+	}
+
+	failingResource := func(_ context.Context, _ interface{}, _ map[string]interface{}) error {
+		return errMapper
+	}
+
+	tests := []struct {
+		name     string
+		failure  middleware.MappingFailure
+		code     codes.Code
+		outcome  middleware.Outcome
+		callback func(*grpcmw.Middleware)
+	}{
+		{
+			"resource mapper errors should fail with INTERNAL by default",
+			middleware.MappingFailureError,
+			codes.Internal,
+			middleware.OutcomeError,
+			func(mw *grpcmw.Middleware) { mw.WithResourceMapperE(failingResource) },
+		},
+		{
+			"missing fields should fail with INVALID_ARGUMENT",
+			middleware.MappingFailureInvalidArgument,
+			codes.InvalidArgument,
+			middleware.OutcomeError,
+			func(mw *grpcmw.Middleware) { mw.WithResourceFromFields("missing") },
+		},
+		{
+			"identity mapper errors should be denied",
+			middleware.MappingFailureDeny,
+			codes.PermissionDenied,
+			middleware.OutcomeDenied,
+			func(mw *grpcmw.Middleware) {
+				mw.Identity.MapperE(func(context.Context, interface{}, middleware.Identity) error {
+					return errMapper
+				})
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event *middleware.Event
+
+			mw := grpcmw.New(mock.New(t, nil), test.Policy(DefaultPolicyPath)).
+				WithMappingFailure(tc.failure).
+				WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+			tc.callback(mw)
+
+			err := call(mw)
+			assert.Equal(t, tc.code, status.Code(err))
+			assert.Equal(t, tc.outcome, event.Outcome)
+			assert.Error(t, event.Err)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/aserto-go/middleware/internal/pbutil"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ErrUnknownMethod is returned from Validate when the middleware configuration refers to methods that aren't
+// registered with the server.
+var ErrUnknownMethod = errors.New("no registered method matches")
+
+// ErrInvalidResourceFields is returned from Validate when fields selected using `WithResourceFromFields()` or
+// `WithResourceFromMessageByPath()` don't exist in the request message of a registered method.
+var ErrInvalidResourceFields = errors.New("invalid resource fields")
+
+// MethodPolicy holds authorization options for calls to one or more gRPC methods.
+type MethodPolicy struct {
+	// Method is the full name of the method (e.g. "/example.ExampleService/Method"), a service prefix that ends
+	// with a slash (e.g. "/example.ExampleService/"), or a glob pattern (e.g. "/example.ExampleService/List*").
+	Method string
+
+	// PolicyID is the ID of the aserto policy to query. If empty, the middleware's policy ID is used.
+	PolicyID string
+
+	// Path is the package name of the rego policy to evaluate. If empty, the policy path is determined the
+	// same way as for methods that don't have a MethodPolicy.
+	Path string
+
+	// Decisions are the authorization rules to evaluate. Calls are only allowed if all decisions are true.
+	// If empty, the middleware's decision is used.
+	Decisions []string
+}
+
+// ServiceInfoProvider is implemented by *grpc.Server and is used to validate the middleware configuration against
+// the services registered with a server.
+type ServiceInfoProvider interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}
+
+/*
+WithMethodPolicies sets the policy ID, path, and decisions to use for calls to specific methods.
+
+Methods are matched against the full name of each policy first. If no policy has the exact method name, the first
+policy with a matching service prefix or pattern is used. Calls to methods that don't match any policy are authorized
+using the middleware's policy, unless `WithDenyByDefault()` is set, in which case they are rejected.
+
+Example:
+
+  middleware.WithMethodPolicies(
+	  grpcmw.MethodPolicy{Method: "/example.ExampleService/List*", Decisions: []string{"visible"}},
+	  grpcmw.MethodPolicy{Method: "/example.ExampleService/", Decisions: []string{"allowed"}},
+  )
+*/
+func (m *Middleware) WithMethodPolicies(policies ...MethodPolicy) *Middleware {
+	m.methodPolicies = append(m.methodPolicies, policies...)
+	return m
+}
+
+/*
+Validate checks the middleware configuration against the services registered with a gRPC server.
+It returns an error if any method policy, exemption, or method passed to `WithResourceFromMessageByPath()` doesn't
+match at least one registered method, if resource fields don't exist in the request messages of the methods they're
+selected from, or if annotations are enabled and a registered method has no valid authorization rule.
+
+Validate should be called at startup, after all services have been registered:
+
+  server := grpc.NewServer(grpc.UnaryInterceptor(mw.Unary()), grpc.StreamInterceptor(mw.Stream()))
+  example.RegisterExampleServiceServer(server, &exampleServer{})
+
+  if err := mw.Validate(server); err != nil {
+	  log.Fatal(err)
+  }
+*/
+func (m *Middleware) Validate(server ServiceInfoProvider) error {
+	methods := registeredMethods(server)
+
+	var unmatched []string
+
+	for _, policy := range m.methodPolicies {
+		if !anyMethodMatches(policy.Method, methods) {
+			unmatched = append(unmatched, policy.Method)
+		}
+	}
+
+	for _, pattern := range m.exemptMethods {
+		if !anyMethodMatches(pattern, methods) {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+
+	for _, selection := range m.resourceFields {
+		for _, method := range selection.methods() {
+			if !anyMethodMatches(method, methods) {
+				unmatched = append(unmatched, method)
+			}
+		}
+	}
+
+	if len(unmatched) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownMethod, strings.Join(unmatched, ", "))
+	}
+
+	if err := m.validateResourceFields(methods); err != nil {
+		return err
+	}
+
+	if m.annotations != nil {
+		return m.validateAnnotations(methods)
+	}
+
+	return nil
+}
+
+func (m *Middleware) validateAnnotations(methods []string) error {
+	var missing, invalid []string
+
+	for _, method := range methods {
+		if _, ok := m.methodPolicy(method); ok || m.isExempt(method) {
+			continue
+		}
+
+		err := m.annotations.validate(method)
+
+		switch {
+		case errors.Is(err, ErrMissingAnnotation):
+			missing = append(missing, method)
+		case err != nil:
+			invalid = append(invalid, err.Error())
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingAnnotation, strings.Join(missing, ", "))
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidAnnotation, strings.Join(invalid, "; "))
+	}
+
+	return nil
+}
+
+// validateResourceFields checks that the fields selected using WithResourceFromFields and
+// WithResourceFromMessageByPath exist in the request messages of the methods they're selected from.
+// Methods whose descriptors aren't registered in the annotation resolver's registry, or in
+// `protoregistry.GlobalFiles` if annotations aren't enabled, are skipped.
+func (m *Middleware) validateResourceFields(methods []string) error {
+	if len(m.resourceFields) == 0 {
+		return nil
+	}
+
+	resolver := m.annotations
+	if resolver == nil {
+		resolver = NewAnnotationResolver(protoregistry.GlobalFiles)
+	}
+
+	var invalid []string
+
+	for _, method := range methods {
+		if m.isExempt(method) {
+			continue
+		}
+
+		desc, err := resolver.methodDescriptor(method)
+		if err != nil {
+			continue
+		}
+
+		for _, selection := range m.resourceFields {
+			fields := selection.fields(method)
+			if len(fields) == 0 {
+				continue
+			}
+
+			if err := pbutil.Validate(desc.Input(), fields...); err != nil {
+				invalid = append(invalid, fmt.Sprintf("%s: %s", method, err.Error()))
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidResourceFields, strings.Join(invalid, "; "))
+	}
+
+	return nil
+}
+
+// policyContext returns the policy context to use when authorizing a call to the specified method.
+// The returned context is nil if no policy applies and the middleware denies such calls by default.
+func (m *Middleware) policyContext(ctx context.Context, method string, req interface{}) *api.PolicyContext {
+	policy := &api.PolicyContext{
+		Id:        m.policy.Id,
+		Path:      m.policy.Path,
+		Decisions: m.policy.Decisions,
+	}
+
+	if m.policyMapper != nil {
+		policy.Path = m.policyMapper(ctx, req)
+	}
+
+	methodPolicy, ok := m.methodPolicy(method)
+	if !ok {
+		methodPolicy, ok = m.annotatedPolicy(method)
+	}
+
+	if !ok {
+		if m.denyByDefault {
+			return nil
+		}
+
+		return policy
+	}
+
+	if methodPolicy.PolicyID != "" {
+		policy.Id = methodPolicy.PolicyID
+	}
+
+	if methodPolicy.Path != "" {
+		policy.Path = methodPolicy.Path
+	}
+
+	if len(methodPolicy.Decisions) > 0 {
+		policy.Decisions = methodPolicy.Decisions
+	}
+
+	return policy
+}
+
+func (m *Middleware) methodPolicy(method string) (*MethodPolicy, bool) {
+	for i := range m.methodPolicies {
+		if m.methodPolicies[i].Method == method {
+			return &m.methodPolicies[i], true
+		}
+	}
+
+	for i := range m.methodPolicies {
+		if matchMethod(m.methodPolicies[i].Method, method) {
+			return &m.methodPolicies[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (m *Middleware) annotatedPolicy(method string) (*MethodPolicy, bool) {
+	rule := m.annotatedRule(method)
+	if rule == nil {
+		return nil, false
+	}
+
+	return &MethodPolicy{Method: method, Path: rule.PolicyPath, Decisions: rule.Decisions}, true
+}
+
+// matchMethod reports whether a full method name matches a method name, service prefix, or glob pattern.
+func matchMethod(pattern, method string) bool {
+	if strings.HasSuffix(pattern, "/") && strings.HasPrefix(method, pattern) {
+		return true
+	}
+
+	return internal.MatchPattern(pattern, method)
+}
+
+func anyMethodMatches(pattern string, methods []string) bool {
+	for _, method := range methods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func registeredMethods(server ServiceInfoProvider) []string {
+	var methods []string
+
+	for service, info := range server.GetServiceInfo() {
+		for _, method := range info.Methods {
+			methods = append(methods, "/"+service+"/"+method.Name)
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
+// checkDecisions returns nil if all the requested decisions are true. Otherwise it returns an error and the name of
+// the first decision that isn't true.
+func checkDecisions(requested []string, decisions []*authz.Decision) (string, error) {
+	if len(decisions) == 0 {
+		return "", cerr.ErrInvalidDecision
+	}
+
+	if len(requested) <= 1 {
+		if !decisions[0].Is {
+			return decisions[0].Decision, cerr.ErrAuthorizationFailed
+		}
+
+		return "", nil
+	}
+
+	results := make(map[string]bool, len(decisions))
+	for _, decision := range decisions {
+		results[decision.Decision] = decision.Is
+	}
+
+	for _, name := range requested {
+		is, ok := results[name]
+		if !ok {
+			return name, cerr.ErrInvalidDecision
+		}
+
+		if !is {
+			return name, cerr.ErrAuthorizationFailed
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,145 @@
+package grpc_test
+
+import (
+	"context"
+	"testing"
+
+	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+const (
+	listMethod   = "/example.ExampleService/ListItems"
+	deleteMethod = "/example.ExampleService/DeleteItem"
+	otherMethod  = "/other.OtherService/Get"
+)
+
+type services map[string]grpc.ServiceInfo
+
+func (s services) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return s
+}
+
+func methodPolicies() []grpcmw.MethodPolicy {
+	return []grpcmw.MethodPolicy{
+		{Method: "/example.ExampleService/List*", Path: "example.list", Decisions: []string{"visible"}},
+		{Method: deleteMethod, Path: "example.delete", Decisions: []string{"allowed", "owner"}},
+	}
+}
+
+func callMethod(mw *grpcmw.Middleware, method string) error {
+	_, err := mw.Unary()(
+		context.Background(),
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(_ context.Context, _ interface{}) (interface{}, error) {
+			return nil, nil
+		},
+	)
+
+	return err
+}
+
+func decision(name string, is bool) *authz.Decision {
+	return &authz.Decision{Decision: name, Is: is}
+}
+
+func TestMethodPolicies(t *testing.T) {
+	t.Run("pattern should set path and decision", func(t *testing.T) {
+		client := mock.New(
+			t,
+			test.Request(test.PolicyPath("example.list"), test.WithDecision("visible")),
+			decision("visible", true),
+		)
+		mw := grpcmw.New(client, test.Policy(DefaultPolicyPath)).WithMethodPolicies(methodPolicies()...)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		assert.NoError(t, callMethod(mw, listMethod))
+	})
+
+	t.Run("all decisions must be true", func(t *testing.T) {
+		expected := test.Request(test.PolicyPath("example.delete"))
+		expected.PolicyContext.Decisions = []string{"allowed", "owner"}
+
+		client := mock.New(t, expected, decision("allowed", true), decision("owner", false))
+		mw := grpcmw.New(client, test.Policy(DefaultPolicyPath)).WithMethodPolicies(methodPolicies()...)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		assert.ErrorIs(t, callMethod(mw, deleteMethod), cerr.ErrAuthorizationFailed)
+	})
+
+	t.Run("missing decisions are invalid", func(t *testing.T) {
+		expected := test.Request(test.PolicyPath("example.delete"))
+		expected.PolicyContext.Decisions = []string{"allowed", "owner"}
+
+		client := mock.New(t, expected, decision("allowed", true))
+		mw := grpcmw.New(client, test.Policy(DefaultPolicyPath)).WithMethodPolicies(methodPolicies()...)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		assert.ErrorIs(t, callMethod(mw, deleteMethod), cerr.ErrInvalidDecision)
+	})
+
+	t.Run("unmatched methods should use the default policy", func(t *testing.T) {
+		client := mock.New(t, test.Request(test.PolicyPath(DefaultPolicyPath)), test.Decision(true))
+		mw := grpcmw.New(client, test.Policy(DefaultPolicyPath)).WithMethodPolicies(methodPolicies()...)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		assert.NoError(t, callMethod(mw, otherMethod))
+	})
+
+	t.Run("unmatched methods should be denied by default", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, nil, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+			WithMethodPolicies(methodPolicies()...).
+			WithDenyByDefault()
+
+		assert.ErrorIs(t, callMethod(mw, otherMethod), cerr.ErrAuthorizationFailed)
+	})
+
+	t.Run("methods without explicit policies should be denied by default", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, nil, test.Decision(true)), test.Policy(DefaultPolicyPath)).WithDenyByDefault()
+
+		assert.ErrorIs(t, callMethod(mw, otherMethod), cerr.ErrAuthorizationFailed)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	server := services{
+		"example.ExampleService": grpc.ServiceInfo{
+			Methods: []grpc.MethodInfo{{Name: "ListItems"}, {Name: "DeleteItem"}},
+		},
+	}
+
+	mw := grpcmw.New(mock.New(t, nil), test.Policy("")).WithMethodPolicies(methodPolicies()...)
+	assert.NoError(t, mw.Validate(server))
+
+	mw.WithExemptMethods("/grpc.health.v1.Health/")
+	assert.ErrorIs(t, mw.Validate(server), grpcmw.ErrUnknownMethod)
+}
+
+func TestValidateResourceFields(t *testing.T) {
+	server := services{
+		"example.ExampleService": grpc.ServiceInfo{Methods: []grpc.MethodInfo{{Name: "Get"}}},
+	}
+
+	newMiddleware := func() *grpcmw.Middleware {
+		return grpcmw.New(mock.New(t, nil), test.Policy("")).
+			WithAnnotations(grpcmw.NewAnnotationResolver(annotatedFiles(t)))
+	}
+
+	assert.NoError(t, newMiddleware().WithResourceFromFields("identity", "type").Validate(server))
+	assert.ErrorIs(
+		t,
+		newMiddleware().WithResourceFromFields("identity.id").Validate(server),
+		grpcmw.ErrInvalidResourceFields,
+	)
+	assert.ErrorIs(
+		t,
+		newMiddleware().WithResourceFromMessageByPath(map[string][]string{otherMethod: {"identity"}}).Validate(server),
+		grpcmw.ErrUnknownMethod,
+	)
+}
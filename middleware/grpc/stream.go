@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// StreamAuthorization determines when the middleware authorizes calls to streaming RPCs.
+type StreamAuthorization int
+
+const (
+	// AuthorizeStreamOnce authorizes streams once, when they are opened.
+	// Since no message has been received at that point, resource mappers that read from incoming messages
+	// (e.g. `WithResourceFromFields`) don't contribute to the resource context.
+	AuthorizeStreamOnce StreamAuthorization = iota
+
+	// AuthorizeEachMessage authorizes streams when they are opened, like AuthorizeStreamOnce, and then authorizes
+	// every message received on the stream, using the message as input to resource and policy mappers.
+	// Mappers that read from incoming messages must handle the nil message passed when the stream is opened.
+	// If a message is denied, the error is returned from the stream's RecvMsg() method and the handler is
+	// responsible for terminating the stream.
+	AuthorizeEachMessage
+)
+
+/*
+WithStreamAuthorization sets the authorization mode for streaming RPCs.
+
+If no methods are specified, the mode applies to all streams that don't have a mode set explicitly.
+Otherwise, the mode only applies to the listed methods, which are identified by their full names.
+
+Example:
+
+  middleware.WithStreamAuthorization(grpcmw.AuthorizeEachMessage, "/example.ExampleService/Upload")
+
+The default mode is AuthorizeStreamOnce.
+*/
+func (m *Middleware) WithStreamAuthorization(mode StreamAuthorization, methods ...string) *Middleware {
+	if len(methods) == 0 {
+		m.streamAuth.defaultMode = mode
+	}
+
+	for _, method := range methods {
+		m.streamAuth.byMethod[method] = mode
+	}
+
+	return m
+}
+
+type streamAuthorization struct {
+	defaultMode StreamAuthorization
+	byMethod    map[string]StreamAuthorization
+}
+
+func (s *streamAuthorization) mode(method string) StreamAuthorization {
+	if mode, ok := s.byMethod[method]; ok {
+		return mode
+	}
+
+	return s.defaultMode
+}
+
+// contextStream wraps a grpc.ServerStream to replace its context.
+type contextStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorizedStream wraps a grpc.ServerStream and authorizes each message it receives.
+// Its context holds the authorization result of the last message that was received, or of the stream itself if no
+// message has been received yet.
+type authorizedStream struct {
+	grpc.ServerStream
+
+	ctx       context.Context
+	method    string
+	authorize func(context.Context, string, interface{}) (context.Context, error)
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	ctx, err := s.authorize(s.ServerStream.Context(), s.method, m)
+	if err != nil {
+		return err
+	}
+
+	s.ctx = ctx
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/twitchtv/twirp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// twirpCodes maps gRPC status codes to Twirp error codes.
+var twirpCodes = map[codes.Code]twirp.ErrorCode{
+	codes.Canceled:           twirp.Canceled,
+	codes.Unknown:            twirp.Unknown,
+	codes.InvalidArgument:    twirp.InvalidArgument,
+	codes.DeadlineExceeded:   twirp.DeadlineExceeded,
+	codes.NotFound:           twirp.NotFound,
+	codes.AlreadyExists:      twirp.AlreadyExists,
+	codes.PermissionDenied:   twirp.PermissionDenied,
+	codes.ResourceExhausted:  twirp.ResourceExhausted,
+	codes.FailedPrecondition: twirp.FailedPrecondition,
+	codes.Aborted:            twirp.Aborted,
+	codes.OutOfRange:         twirp.OutOfRange,
+	codes.Unimplemented:      twirp.Unimplemented,
+	codes.Internal:           twirp.Internal,
+	codes.Unavailable:        twirp.Unavailable,
+	codes.DataLoss:           twirp.DataLoss,
+	codes.Unauthenticated:    twirp.Unauthenticated,
+}
+
+type twirpHeadersKey struct{}
+
+/*
+Twirp returns a twirp.Interceptor that authorizes calls to Twirp services the same way Unary() authorizes gRPC calls.
+
+Methods are named like gRPC methods, using the Twirp package, service and method names (e.g.
+"/example.Haberdasher/MakeHat"), so the default policy path is "example.Haberdasher.MakeHat" and method policies,
+annotations, exemptions and resource field selection apply to both kinds of servers.
+
+Twirp servers don't pass request headers to interceptors. To read the caller's identity from headers, wrap the server
+with TwirpHandler:
+
+  server := example.NewHaberdasherServer(service, twirp.WithServerInterceptors(middleware.Twirp()))
+  http.Handle(server.PathPrefix(), grpcmw.TwirpHandler(server))
+
+Rejected calls fail with a twirp.Error whose code corresponds to the gRPC status the interceptors return. Denial
+details added with `WithDenialDetails()` are included in the error's metadata.
+*/
+func (m *Middleware) Twirp() twirp.Interceptor {
+	return func(next twirp.Method) twirp.Method {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			header, _ := ctx.Value(twirpHeadersKey{}).(http.Header)
+
+			ctx, err := m.authorizeWithHeaders(ctx, twirpMethod(ctx), header, req)
+			if err != nil {
+				return nil, twirpError(err)
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// TwirpHandler wraps a Twirp server so that the interceptor returned by `Middleware.Twirp()` can read request headers.
+func TwirpHandler(server http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), twirpHeadersKey{}, r.Header)
+		server.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// twirpMethod returns the gRPC-style full name of the Twirp method being called.
+func twirpMethod(ctx context.Context) string {
+	pkg, _ := twirp.PackageName(ctx)
+	service, _ := twirp.ServiceName(ctx)
+	method, _ := twirp.MethodName(ctx)
+
+	if pkg != "" {
+		service = pkg + "." + service
+	}
+
+	return fmt.Sprintf("/%s/%s", service, method)
+}
+
+// twirpError converts an error returned by the gRPC interceptors to a twirp.Error. The metadata of ErrorInfo details
+// is added to the error's metadata.
+func twirpError(err error) error {
+	st := status.Convert(err)
+
+	code, ok := twirpCodes[st.Code()]
+	if !ok {
+		code = twirp.Unknown
+	}
+
+	twerr := twirp.NewError(code, st.Message())
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			for key, value := range info.Metadata {
+				twerr = twerr.WithMeta(key, value)
+			}
+		}
+	}
+
+	return twerr
+}
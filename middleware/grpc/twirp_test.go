@@ -0,0 +1,76 @@
+package grpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	grpcmw "github.com/aserto-dev/aserto-go/middleware/grpc"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twitchtv/twirp"
+	"github.com/twitchtv/twirp/ctxsetters"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// twirpCall sends a request through TwirpHandler and calls the middleware's interceptor the way generated Twirp
+// servers do.
+func twirpCall(mw *grpcmw.Middleware, handled *bool) error {
+	var err error
+
+	server := grpcmw.TwirpHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ctx := ctxsetters.WithPackageName(r.Context(), "example")
+		ctx = ctxsetters.WithServiceName(ctx, "Haberdasher")
+		ctx = ctxsetters.WithMethodName(ctx, "MakeHat")
+
+		method := mw.Twirp()(func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, *handled = middleware.AuthorizationResultFromContext(ctx)
+			return req, nil
+		})
+
+		_, err = method(ctx, &api.PolicyContext{Path: "hats.make"})
+	}))
+
+	req := httptest.NewRequest("POST", "/twirp/example.Haberdasher/MakeHat", nil)
+	req.Header.Set("Authorization", "Bearer "+test.DefaultUsername)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	return err
+}
+
+func TestTwirp(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"path": "hats.make"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("example.Haberdasher.MakeHat"), test.Resource(resource))
+
+	t.Run("allowed calls should reach the handler", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithResourceFromFields("path")
+
+		var handled bool
+
+		assert.NoError(t, twirpCall(mw, &handled))
+		assert.True(t, handled)
+	})
+
+	t.Run("denied calls should fail with permission denied", func(t *testing.T) {
+		mw := grpcmw.New(mock.New(t, expected, test.Decision(false)), test.Policy("")).
+			WithResourceFromFields("path").
+			WithDenialDetails(middleware.DenialDetailsOptions{})
+
+		var handled bool
+
+		err := twirpCall(mw, &handled)
+		assert.False(t, handled)
+
+		var twerr twirp.Error
+		require.ErrorAs(t, err, &twerr)
+		assert.Equal(t, twirp.PermissionDenied, twerr.Code())
+		assert.Equal(t, "example.Haberdasher.MakeHat", twerr.Meta("policy_path"))
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"time"
+)
+
+// Outcome describes how authorization middleware handled a request.
+type Outcome int
+
+const (
+	// OutcomeAllowed indicates that the request was authorized and passed on to its handler.
+	OutcomeAllowed Outcome = iota
+
+	// OutcomeDenied indicates that the request was rejected, either by the authorizer or because no policy
+	// applies to it and the middleware denies such requests by default.
+	OutcomeDenied
+
+	// OutcomeExempt indicates that the request matched an exemption rule and was passed on to its handler
+	// without an authorization call.
+	OutcomeExempt
+
+	// OutcomeError indicates that the request couldn't be authorized due to an error.
+	OutcomeError
+
+	// OutcomeUnauthenticated indicates that the request was rejected because the caller's identity couldn't be
+	// verified.
+	OutcomeUnauthenticated
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeAllowed:
+		return "allowed"
+	case OutcomeDenied:
+		return "denied"
+	case OutcomeExempt:
+		return "exempt"
+	case OutcomeError:
+		return "error"
+	case OutcomeUnauthenticated:
+		return "unauthenticated"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a request handled by authorization middleware.
+type Event struct {
+	// Outcome is the result of the authorization check.
+	Outcome Outcome
+
+	// Operation identifies the request. In gRPC middleware it is the full method name (e.g.
+	// "/example.ExampleService/Method"). In HTTP middleware it is the request method and URL path
+	// (e.g. "GET /api/products/123"), which includes the host for outgoing requests. In message queue middleware it
+	// is the policy path.
+	Operation string
+
+	// PolicyPath is the path of the policy evaluated by the authorizer. It is empty for exempt requests.
+	PolicyPath string
+
+	// Err is the error that caused the request to fail. It is only set when Outcome is OutcomeError or
+	// OutcomeUnauthenticated.
+	Err error
+
+	// Duration is the time spent by the middleware handling the request.
+	Duration time.Duration
+}
+
+// Hook functions are called with an Event for every request handled by authorization middleware.
+// They can be used to collect metrics or write audit logs.
+type Hook func(context.Context, *Event)
@@ -0,0 +1,74 @@
+/*
+Package chiz provides authorization middleware for HTTP servers built using go-chi/chi.
+
+The middleware is the net/http middleware from the std package, configured to read route templates and URL
+parameters from chi's routing context.
+*/
+package chiz
+
+import (
+	"net/http"
+
+	"github.com/aserto-dev/aserto-go/middleware/http/std"
+	"github.com/go-chi/chi/v5"
+)
+
+// New creates middleware for the specified policy that constructs policy paths from chi route patterns and adds
+// chi URL parameters to the resource context.
+//
+// The middleware can be installed anywhere in a chi router, including with `Use()` on the top-level router, where it
+// runs before chi has matched the request to a route.
+//
+// Example
+//
+// Using 'New(client, policy).WithPolicyFromURL("myapp")', the route
+//   r.Post("/products/{id}", handler)
+// becomes the policy path
+//  "myapp.POST.products.__id"
+func New(client std.AuthorizerClient, policy std.Policy) *std.Middleware {
+	return std.New(client, policy).WithRouteMappers(Route)
+}
+
+// Route is a std.RouteMapper for requests routed by chi. It can be used to add chi support to existing std
+// middleware:
+//
+//   mw.WithRouteMappers(chiz.Route, std.GorillaRoute)
+//
+// If the request hasn't been routed yet, it is matched against the router's routes. Wildcard ("*") parameters
+// aren't included in the route's parameters.
+func Route(r *http.Request) (std.Route, bool) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return std.Route{}, false
+	}
+
+	if rctx.Routes != nil {
+		// Middleware added with Use() runs before chi routes the request. Match the full path from the top-level
+		// router to find the route pattern and all URL parameters.
+		match := chi.NewRouteContext()
+		if !rctx.Routes.Match(match, r.Method, requestPath(r)) {
+			return std.Route{}, false
+		}
+
+		rctx = match
+	}
+
+	params := map[string]string{}
+
+	for i, key := range rctx.URLParams.Keys {
+		if key != "*" && i < len(rctx.URLParams.Values) {
+			params[key] = rctx.URLParams.Values[i]
+		}
+	}
+
+	return std.Route{Template: rctx.RoutePattern(), Params: params}, true
+}
+
+// requestPath returns the path chi uses to route r.
+func requestPath(r *http.Request) string {
+	if r.URL.RawPath != "" {
+		return r.URL.RawPath
+	}
+
+	return r.URL.Path
+}
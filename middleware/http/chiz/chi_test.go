@@ -0,0 +1,89 @@
+package chiz_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware/http/chiz"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func serve(h http.Handler, path string) *http.Response {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+func TestRoutePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		params   map[string]interface{}
+	}{
+		{"route with param", "/products/123", "myapp.GET.products.__id", map[string]interface{}{"id": "123"}},
+		{"regex param", "/orders/42", "myapp.GET.orders.__num", map[string]interface{}{"num": "42"}},
+		{
+			"mounted router",
+			"/stores/abc/items/7",
+			"myapp.GET.stores.__store.items.__item",
+			map[string]interface{}{"store": "abc", "item": "7"},
+		},
+		{"route without params", "/health", "myapp.GET.health", map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := structpb.NewStruct(tt.params)
+			require.NoError(t, err)
+
+			expected := test.Request(test.PolicyPath(tt.expected), test.Resource(resource))
+			mw := chiz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithPolicyFromURL("myapp")
+
+			items := chi.NewRouter()
+			items.Get("/items/{item}", ok)
+
+			r := chi.NewRouter()
+			r.Use(mw.Handler)
+			r.Get("/products/{id}", ok)
+			r.Get("/orders/{num:[0-9]+}", ok)
+			r.Get("/health", ok)
+			r.Mount("/stores/{store}", items)
+
+			resp := serve(r, tt.path)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestInlineMiddleware(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("GET.products.__id"), test.Resource(resource))
+	mw := chiz.New(mock.New(t, expected, test.Decision(true)), test.Policy(""))
+
+	r := chi.NewRouter()
+	r.With(mw.Handler).Get("/products/{id}", ok)
+
+	resp := serve(r, "/products/123")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+)
+
+// SessionStore resolves session IDs to the subjects of the users they belong to.
+type SessionStore interface {
+	// Subject returns the subject of the user that owns a session. It returns an empty string if the session
+	// doesn't exist or has expired.
+	Subject(ctx context.Context, sessionID string) (string, error)
+}
+
+// SessionStoreFunc is an adapter that allows the use of ordinary functions as session stores.
+type SessionStoreFunc func(ctx context.Context, sessionID string) (string, error)
+
+func (f SessionStoreFunc) Subject(ctx context.Context, sessionID string) (string, error) {
+	return f(ctx, sessionID)
+}
+
+// FromCookie retrieves caller identity from the value of a cookie.
+//
+// If the cookie holds a JWT, it can be verified using VerifyJWT().
+// If the cookie isn't present or is empty, the request is considered anonymous.
+func (b *IdentityBuilder) FromCookie(name string) *IdentityBuilder {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
+		identity.ID(cookieValue(r, name))
+	})
+}
+
+// FromSignedCookie retrieves caller identity from a cookie signed with HMAC-SHA256.
+//
+// Signed values have the form "<value>.<signature>", where the signature is the unpadded base64url encoding of the
+// HMAC-SHA256 of the value. Use SignCookieValue to create them.
+// Multiple keys can be specified to support key rotation. Values signed with any of them are accepted.
+//
+// If the cookie isn't present or its signature is invalid, the request is considered anonymous.
+func (b *IdentityBuilder) FromSignedCookie(name string, keys ...[]byte) *IdentityBuilder {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
+		value, ok := internal.VerifySignedValue(cookieValue(r, name), keys)
+		if !ok {
+			identity.None()
+			return
+		}
+
+		identity.ID(value)
+	})
+}
+
+// FromSession retrieves caller identity by looking up the session ID in a cookie in a session store.
+// The identity type is set to subject.
+//
+// If the cookie isn't present or the session isn't found, the request is considered anonymous. If the store returns
+// an error, the middleware rejects the request according to its `WithMappingFailure()` setting.
+func (b *IdentityBuilder) FromSession(cookie string, store SessionStore) *IdentityBuilder {
+	return b.MapperE(func(r *http.Request, identity middleware.Identity) error {
+		sessionID := cookieValue(r, cookie)
+		if sessionID == "" {
+			identity.None()
+			return nil
+		}
+
+		subject, err := store.Subject(r.Context(), sessionID)
+		if err != nil {
+			return err
+		}
+
+		if subject == "" {
+			identity.None()
+			return nil
+		}
+
+		identity.Subject().ID(subject)
+
+		return nil
+	})
+}
+
+// SignCookieValue returns a cookie value signed with HMAC-SHA256 that can be read using
+// IdentityBuilder.FromSignedCookie().
+func SignCookieValue(key []byte, value string) string {
+	return internal.SignValue(key, value)
+}
+
+func cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
@@ -0,0 +1,322 @@
+package echoz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type (
+	Policy           = middleware.Policy
+	AuthorizerClient = authorizer.AuthorizerClient
+)
+
+// AuthorizationResultKey is the echo context key under which the middleware stores the
+// `*middleware.AuthorizationResult` of allowed requests.
+const AuthorizationResultKey = "aserto.authorization_result"
+
+// AuthorizationResult returns the result of the authorization call made for a request, or false if the request
+// wasn't authorized by the middleware (e.g. because it is exempt).
+//
+// The result is also stored in the context of the request (`c.Request().Context()`) and can be retrieved with
+// `middleware.AuthorizationResultFromContext`.
+func AuthorizationResult(c echo.Context) (*middleware.AuthorizationResult, bool) {
+	result, ok := c.Get(AuthorizationResultKey).(*middleware.AuthorizationResult)
+	return result, ok
+}
+
+// Middleware implements middleware that can be added to routes in Echo servers. It is configured like the
+// net/http middleware in package std.
+type Middleware struct {
+	// Identity determines the caller identity used in authorization calls.
+	Identity *httpmw.IdentityBuilder
+
+	authz internal.HTTPAuthorizer[echo.Context]
+}
+
+type (
+	// StringMapper functions are used to extract string values from incoming requests.
+	// They are used to define policy mappers.
+	StringMapper func(echo.Context) string
+
+	// StructMapper functions are used to extract structured data from incoming requests.
+	// The optional resource mapper is a StructMapper.
+	StructMapper func(echo.Context) *structpb.Struct
+
+	// StructMapperE is like StructMapper but can return an error if the resource can't be determined.
+	StructMapperE func(echo.Context) (*structpb.Struct, error)
+)
+
+// New creates middleware for the specified policy.
+//
+// The new middleware is created with default identity and policy path mapper.
+// Those can be overridden using `Middleware.Identity` to specify the caller's identity, or using
+// the middleware's ".With...()" functions to set policy path and resource mappers.
+func New(client AuthorizerClient, policy Policy) *Middleware {
+	m := &Middleware{Identity: (&httpmw.IdentityBuilder{}).FromHeader("Authorization")}
+
+	m.authz = internal.HTTPAuthorizer[echo.Context]{
+		Client:          client,
+		Policy:          internal.DefaultPolicyContext(policy),
+		Identity:        func(c echo.Context) (*api.IdentityContext, error) { return m.Identity.Resolve(c.Request()) },
+		ResourceMappers: []internal.ResourceMapper[echo.Context]{pathParamsResourceMapper},
+		MaxBodySize:     internal.DefaultMaxBodySize,
+	}
+
+	if policy.Path == "" {
+		m.authz.PolicyMapper = urlPolicyPathMapper("")
+	}
+
+	return m
+}
+
+// Handler is the middleware implementation. It is how an Authorizer is wired to an Echo server:
+//
+//   e.Use(mw.Handler)
+//
+// Rejected requests are returned as `*echo.HTTPError` values, which are handled by the server's HTTPErrorHandler,
+// except for denials with details set by `WithDenialDetails()`.
+func (m *Middleware) Handler(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		decision := m.authz.Authorize(r.Context(), c, r.Method, r.URL.Path)
+
+		switch {
+		case decision.Allowed && decision.Result != nil:
+			c.Set(AuthorizationResultKey, decision.Result)
+			c.SetRequest(r.WithContext(middleware.ContextWithAuthorizationResult(r.Context(), decision.Result)))
+
+			return next(c)
+		case decision.Allowed:
+			return next(c)
+		case decision.Problem != nil:
+			return c.Blob(decision.Status, internal.ProblemContentType, decision.Problem)
+		case decision.Challenge != "":
+			c.Response().Header().Set("WWW-Authenticate", decision.Challenge)
+		}
+
+		if decision.Status == http.StatusBadRequest {
+			return echo.NewHTTPError(decision.Status, decision.Err.Error()).SetInternal(decision.Err)
+		}
+
+		return echo.NewHTTPError(decision.Status).SetInternal(decision.Err)
+	}
+}
+
+// WithPolicyFromURL instructs the middleware to construct the policy path from the path segment
+// of the incoming request's URL.
+//
+// Path separators ('/') are replaced with dots ('.'). If the route has path parameters, those are added to the path
+// with two leading underscores.
+// An optional prefix can be specified to be included in all paths.
+//
+// Example
+//
+// Using 'WithPolicyFromURL("myapp")', the route
+//   POST /products/:id
+// becomes the policy path
+//  "myapp.POST.products.__id"
+func (m *Middleware) WithPolicyFromURL(prefix string) *Middleware {
+	m.authz.PolicyMapper = urlPolicyPathMapper(prefix)
+	return m
+}
+
+// WithPolicyPathMapper sets a custom policy mapper, a function that takes an incoming request
+// and returns the path within the policy of the package to query.
+func (m *Middleware) WithPolicyPathMapper(mapper StringMapper) *Middleware {
+	m.authz.PolicyMapper = mapper
+	return m
+}
+
+// WithNoResourceContext causes the middleware to include no resource context in authorization request instead
+// of the default behavior that sends all URL path parameters.
+//
+// Resource mappers added after WithNoResourceContext() are still applied.
+func (m *Middleware) WithNoResourceContext() *Middleware {
+	m.authz.ResourceMappers = nil
+	return m
+}
+
+// WithResourceMapper adds a custom resource mapper, a function that takes an incoming request and returns resource
+// fields as a `structpb.Struct`. Resource mappers are applied in the order they are added, starting with the default
+// mapper that adds route parameters, and merged according to `WithResourceConflict()`.
+func (m *Middleware) WithResourceMapper(mapper StructMapper) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		return mapper(c).AsMap(), nil
+	})
+}
+
+// WithResourceMapperE adds a custom resource mapper that can return an error. If it does, the request is rejected
+// according to the `WithMappingFailure()` setting.
+func (m *Middleware) WithResourceMapperE(mapper StructMapperE) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		res, err := mapper(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.AsMap(), nil
+	})
+}
+
+// WithResourceFromContextValue adds the value associated with a key in the request context to the resource context,
+// under the specified field name.
+func (m *Middleware) WithResourceFromContextValue(ctxKey interface{}, field string) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		value := c.Request().Context().Value(ctxKey)
+		if value == nil {
+			return nil, nil
+		}
+
+		return map[string]interface{}{field: value}, nil
+	})
+}
+
+// WithResourceFromBody adds fields from JSON request bodies, selected using dot-separated paths, to the resource
+// context. See `std.Middleware.WithResourceFromBody()`.
+func (m *Middleware) WithResourceFromBody(paths ...string) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		return internal.BodyFields(c.Request(), m.authz.MaxBodySize, paths), nil
+	})
+}
+
+// WithResourceFromQuery adds query string parameters to the resource context. Parameters with multiple values are
+// added as lists.
+func (m *Middleware) WithResourceFromQuery(params ...string) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		return internal.QueryFields(c.Request(), params), nil
+	})
+}
+
+// WithResourceFromHeaders adds the values of request headers to the resource context, keyed by header name.
+func (m *Middleware) WithResourceFromHeaders(headers ...string) *Middleware {
+	return m.addResourceMapper(func(c echo.Context) (map[string]interface{}, error) {
+		return internal.HeaderFields(c.Request(), headers), nil
+	})
+}
+
+// WithMaxBodySize sets the maximum number of bytes read from request bodies by `WithResourceFromBody()`.
+// The default is 1MiB.
+func (m *Middleware) WithMaxBodySize(bytes int64) *Middleware {
+	m.authz.MaxBodySize = bytes
+	return m
+}
+
+// WithMappingFailure sets how the middleware responds to requests for which a resource or identity mapper returns
+// an error. The default is `middleware.MappingFailureError`, which responds with status 500.
+func (m *Middleware) WithMappingFailure(failure middleware.MappingFailure) *Middleware {
+	m.authz.MappingFailure = failure
+	return m
+}
+
+// WithResourceConflict sets the rule used to combine fields with the same name from different resource mappers.
+// The default is `middleware.ResourceOverwrite`, where fields from later mappers replace those from earlier ones.
+func (m *Middleware) WithResourceConflict(conflict middleware.ResourceConflict) *Middleware {
+	m.authz.ResourceConflict = conflict
+	return m
+}
+
+func (m *Middleware) addResourceMapper(mapper internal.ResourceMapper[echo.Context]) *Middleware {
+	m.authz.ResourceMappers = append(m.authz.ResourceMappers, mapper)
+	return m
+}
+
+// WithExemptRoute instructs the middleware to pass requests that match the specified HTTP method and URL path
+// pattern on to the next handler without authorizing them. See `std.Middleware.WithExemptRoute()` for the pattern
+// syntax.
+func (m *Middleware) WithExemptRoute(method, pattern string) *Middleware {
+	m.authz.ExemptRoutes = append(m.authz.ExemptRoutes, internal.RouteRule{Method: method, Pattern: pattern})
+	return m
+}
+
+// WithRoutePolicy instructs the middleware to evaluate the specified policy path for requests that match the HTTP
+// method and URL path pattern. See `std.Middleware.WithRoutePolicy()`.
+func (m *Middleware) WithRoutePolicy(method, pattern, policyPath string) *Middleware {
+	m.authz.RoutePolicies = append(
+		m.authz.RoutePolicies,
+		internal.RouteRule{Method: method, Pattern: pattern, PolicyPath: policyPath},
+	)
+
+	return m
+}
+
+// WithDenyByDefault instructs the middleware to reject requests that don't match a route set with
+// `WithRoutePolicy()` without sending them to the authorizer. See `std.Middleware.WithDenyByDefault()`.
+func (m *Middleware) WithDenyByDefault() *Middleware {
+	m.authz.DenyByDefault = true
+	return m
+}
+
+// WithHook adds a function to be called with the outcome of each request handled by the middleware.
+// Hooks can be used to collect metrics or write audit logs.
+func (m *Middleware) WithHook(hook middleware.Hook) *Middleware {
+	m.authz.Hooks = append(m.authz.Hooks, hook)
+	return m
+}
+
+// WithDenialDetails instructs the middleware to respond to denied requests with an RFC 7807 problem details body
+// (content type "application/problem+json") that includes the evaluated policy path, the name of the decision that
+// was denied, and the policy's reason if it has one.
+//
+// The middleware writes these responses itself instead of returning an `*echo.HTTPError`, because Echo's error
+// handler would send the details as "application/json". Denials without details are still returned as errors.
+//
+// If options.IncludeOutputs is set, the values of all rules in the policy are included as well.
+// Use options.Redact to remove sensitive information before details are sent to callers.
+func (m *Middleware) WithDenialDetails(options middleware.DenialDetailsOptions) *Middleware {
+	m.authz.DenialDetails = &options
+	return m
+}
+
+func pathParamsResourceMapper(c echo.Context) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	values := c.ParamValues()
+
+	for i, name := range c.ParamNames() {
+		if i < len(values) {
+			vars[name] = values[i]
+		}
+	}
+
+	return vars, nil
+}
+
+func urlPolicyPathMapper(prefix string) StringMapper {
+	return func(c echo.Context) string {
+		policyPath := []string{c.Request().Method}
+
+		segments := getPathSegments(c)
+
+		if len(c.ParamNames()) > 0 {
+			for i, segment := range segments {
+				if strings.HasPrefix(segment, ":") {
+					segments[i] = "__" + segment[1:]
+				}
+			}
+		}
+
+		policyPath = append(policyPath, segments...)
+
+		if prefix != "" {
+			policyPath = append([]string{strings.Trim(prefix, ".")}, policyPath...)
+		}
+
+		return strings.Join(policyPath, ".")
+	}
+}
+
+func getPathSegments(c echo.Context) []string {
+	path := c.Request().URL.Path
+	if len(c.ParamNames()) > 0 {
+		path = c.Path()
+	}
+
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
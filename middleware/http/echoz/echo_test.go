@@ -0,0 +1,151 @@
+package echoz_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/http/echoz"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newServer(mw *echoz.Middleware, handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	e.Use(mw.Handler)
+	e.GET("/products/:id", handler)
+
+	return e
+}
+
+func serve(e *echo.Echo, path string) *http.Response {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+func TestRouteParams(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.GET.products.__id"), test.Resource(resource))
+	mw := echoz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithPolicyFromURL("myapp")
+
+	var (
+		result  *middleware.AuthorizationResult
+		stored  bool
+		fromCtx bool
+	)
+
+	e := newServer(mw, func(c echo.Context) error {
+		result, stored = echoz.AuthorizationResult(c)
+		_, fromCtx = middleware.AuthorizationResultFromContext(c.Request().Context())
+
+		return c.NoContent(http.StatusOK)
+	})
+
+	resp := serve(e, "/products/123")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, stored)
+	assert.True(t, fromCtx)
+	assert.Equal(t, "myapp.GET.products.__id", result.Policy.Path)
+}
+
+func TestDenied(t *testing.T) {
+	policy := test.Policy("policy.path")
+
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("policy.path"), test.Resource(resource))
+
+	t.Run("denials should be handled by the error handler", func(t *testing.T) {
+		var event *middleware.Event
+
+		mw := echoz.New(mock.New(t, expected, test.Decision(false)), policy).
+			WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		var handled error
+
+		e := newServer(mw, func(c echo.Context) error {
+			t.Error("denied requests shouldn't reach the handler")
+			return nil
+		})
+		e.HTTPErrorHandler = func(err error, c echo.Context) {
+			handled = err
+			e.DefaultHTTPErrorHandler(err, c)
+		}
+
+		resp := serve(e, "/products/123")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, middleware.OutcomeDenied, event.Outcome)
+
+		var httpErr *echo.HTTPError
+		require.ErrorAs(t, handled, &httpErr)
+		assert.Equal(t, http.StatusForbidden, httpErr.Code)
+	})
+
+	t.Run("denial details should be sent as problem details", func(t *testing.T) {
+		mw := echoz.New(mock.New(t, expected, test.Decision(false)), policy).
+			WithDenialDetails(middleware.DenialDetailsOptions{})
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		resp := serve(newServer(mw, nil), "/products/123")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "policy.path", body["policy_path"])
+		assert.Equal(t, test.DefaultDecision, body["decision"])
+	})
+}
+
+func TestDenyByDefault(t *testing.T) {
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+	t.Run("requests that match no route should be rejected", func(t *testing.T) {
+		mw := echoz.New(mock.New(t, nil), test.Policy("")).
+			WithRoutePolicy("GET", "/orders/*", "myapp.orders").
+			WithDenyByDefault()
+
+		resp := serve(newServer(mw, ok), "/products/123")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("routes with a policy should be authorized", func(t *testing.T) {
+		resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+		require.NoError(t, err)
+
+		expected := test.Request(test.PolicyPath("myapp.products"), test.Resource(resource))
+
+		mw := echoz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products").
+			WithDenyByDefault()
+
+		resp := serve(newServer(mw, ok), "/products/123")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
@@ -0,0 +1,195 @@
+package fiberz_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http"
+	"github.com/aserto-dev/aserto-go/middleware/http/fiberz"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var cookieKey = []byte("secret")
+
+func newApp(mw *fiberz.Middleware, handler fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Get("/products/:id<int>", mw.Handler, handler)
+
+	return app
+}
+
+func serve(t *testing.T, app *fiber.App, req *http.Request) *http.Response {
+	t.Helper()
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func request(path string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", test.DefaultUsername)
+
+	return req
+}
+
+func ok(c *fiber.Ctx) error {
+	return c.SendStatus(http.StatusOK)
+}
+
+func TestRouteParams(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.GET.products.__id"), test.Resource(resource))
+	mw := fiberz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithPolicyFromURL("myapp")
+
+	var (
+		result  *middleware.AuthorizationResult
+		stored  bool
+		fromCtx bool
+	)
+
+	app := newApp(mw, func(c *fiber.Ctx) error {
+		result, stored = fiberz.AuthorizationResult(c)
+		_, fromCtx = middleware.AuthorizationResultFromContext(c.UserContext())
+
+		return ok(c)
+	})
+
+	resp := serve(t, app, request("/products/123"))
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, stored)
+	assert.True(t, fromCtx)
+	assert.Equal(t, "myapp.GET.products.__id", result.Policy.Path)
+}
+
+func TestIdentityAndResources(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"id":      "123",
+		"region":  []interface{}{"us", "eu"},
+		"product": map[string]interface{}{"type": "book"},
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("policy.path"), test.Resource(resource))
+	mw := fiberz.New(mock.New(t, expected, test.Decision(true)), test.Policy("policy.path")).
+		WithResourceFromQuery("region").
+		WithResourceFromBody("product.type")
+	mw.Identity.Subject().FromSignedCookie("session", cookieKey)
+
+	body := strings.NewReader(`{"product": {"type": "book", "name": "Dune"}}`)
+	req := httptest.NewRequest("GET", "/products/123?region=us&region=eu", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session", Value: httpmw.SignCookieValue(cookieKey, test.DefaultUsername)})
+
+	resp := serve(t, newApp(mw, ok), req)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestSessionStoreError(t *testing.T) {
+	errStore := errors.New("store unavailable")
+	store := httpmw.SessionStoreFunc(func(context.Context, string) (string, error) {
+		return "", errStore
+	})
+
+	var event *middleware.Event
+
+	mw := fiberz.New(mock.New(t, nil), test.Policy("policy.path")).
+		WithMappingFailure(middleware.MappingFailureInvalidArgument).
+		WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+	mw.Identity.FromSession("session", store)
+
+	req := httptest.NewRequest("GET", "/products/123", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "session-id"})
+
+	resp := serve(t, newApp(mw, ok), req)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, middleware.OutcomeError, event.Outcome)
+	assert.ErrorIs(t, event.Err, errStore)
+}
+
+func TestDenied(t *testing.T) {
+	policy := test.Policy("policy.path")
+
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("policy.path"), test.Resource(resource))
+
+	t.Run("denials should be returned as fiber errors", func(t *testing.T) {
+		mw := fiberz.New(mock.New(t, expected, test.Decision(false)), policy)
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		resp := serve(t, newApp(mw, func(c *fiber.Ctx) error {
+			t.Error("denied requests shouldn't reach the handler")
+			return nil
+		}), request("/products/123"))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("denial details should be sent in the body", func(t *testing.T) {
+		mw := fiberz.New(mock.New(t, expected, test.Decision(false)), policy).
+			WithDenialDetails(middleware.DenialDetailsOptions{})
+		mw.Identity.Subject().ID(test.DefaultUsername)
+
+		resp := serve(t, newApp(mw, ok), request("/products/123"))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "policy.path", body["policy_path"])
+		assert.Equal(t, test.DefaultDecision, body["decision"])
+	})
+}
+
+func TestDenyByDefault(t *testing.T) {
+	t.Run("requests that match no route should be rejected", func(t *testing.T) {
+		mw := fiberz.New(mock.New(t, nil), test.Policy("")).
+			WithRoutePolicy("GET", "/orders/*", "myapp.orders").
+			WithDenyByDefault()
+
+		resp := serve(t, newApp(mw, ok), request("/products/123"))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("routes with a policy should be authorized", func(t *testing.T) {
+		resource, err := structpb.NewStruct(map[string]interface{}{"id": "123"})
+		require.NoError(t, err)
+
+		expected := test.Request(test.PolicyPath("myapp.products"), test.Resource(resource))
+
+		mw := fiberz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products").
+			WithDenyByDefault()
+
+		resp := serve(t, newApp(mw, ok), request("/products/123"))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
@@ -0,0 +1,259 @@
+package fiberz
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/gofiber/fiber/v2"
+)
+
+// IdentityMapper is the type of callback functions that can inspect incoming fiber requests
+// and set the caller's identity.
+type IdentityMapper func(*fiber.Ctx, middleware.Identity)
+
+// IdentityMapperE is like IdentityMapper but can return an error if the caller's identity can't be determined.
+type IdentityMapperE func(*fiber.Ctx, middleware.Identity) error
+
+// IdentityBuilder is used to configure what information about caller identity is sent in authorization calls.
+//
+// It provides the same identity sources as the net/http IdentityBuilder, reading them directly from the fiber
+// request.
+type IdentityBuilder struct {
+	builder internal.IdentityBuilder[*fiber.Ctx]
+}
+
+// Static values
+
+// Call JWT() to indicate that the user's identity is expressed as a string-encoded JWT.
+//
+// JWT() is always called in conjunction with another method that provides the user ID itself.
+// For example:
+//
+//  idBuilder.JWT().FromHeader("Authorization")
+func (b *IdentityBuilder) JWT() *IdentityBuilder {
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_JWT)
+	return b
+}
+
+// Call Subject() to indicate that the user's identity is a subject name (email, userid, etc.).
+//
+// Subject() is always used in conjunction with another method that provides the user ID itself.
+// For example:
+//
+//  idBuilder.Subject().FromLocal("username")
+func (b *IdentityBuilder) Subject() *IdentityBuilder {
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_SUB)
+	return b
+}
+
+// Call None() to indicate that requests are unauthenticated.
+func (b *IdentityBuilder) None() *IdentityBuilder {
+	b.builder.None()
+	return b
+}
+
+// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, the identity type
+// is inferred from the identity: values that parse as JWTs are sent as JWTs and other values as subjects.
+// Passing an empty string is the same as calling .None() and results in an authorization check for anonymous access.
+func (b *IdentityBuilder) ID(identity string) *IdentityBuilder {
+	b.builder.SetID(identity)
+	return b
+}
+
+// FromHeader retrieves caller identity from request headers.
+//
+// Headers are attempted in order. The first non-empty header is used.
+// If none of the specified headers have a value, the request is considered anonymous.
+// The "Bearer" authentication scheme is removed from the value of the Authorization header.
+func (b *IdentityBuilder) FromHeader(header ...string) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		for _, h := range header {
+			id := internal.IdentityValue(h, c.Get(h))
+			if id == "" {
+				continue
+			}
+
+			identity.ID(strings.Clone(id))
+
+			return
+		}
+
+		// None of the specified headers are present in the request.
+		identity.None()
+	})
+}
+
+// FromCookie retrieves caller identity from the value of a cookie.
+//
+// If the cookie holds a JWT, it can be verified using VerifyJWT().
+// If the cookie isn't present or is empty, the request is considered anonymous.
+func (b *IdentityBuilder) FromCookie(name string) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		identity.ID(strings.Clone(c.Cookies(name)))
+	})
+}
+
+// FromSignedCookie retrieves caller identity from a cookie signed with HMAC-SHA256.
+// Values are signed with `httpmw.SignCookieValue()`. Multiple keys can be specified to support key rotation.
+//
+// If the cookie isn't present or its signature is invalid, the request is considered anonymous.
+func (b *IdentityBuilder) FromSignedCookie(name string, keys ...[]byte) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		value, ok := internal.VerifySignedValue(c.Cookies(name), keys)
+		if !ok {
+			identity.None()
+			return
+		}
+
+		identity.ID(strings.Clone(value))
+	})
+}
+
+// FromSession retrieves caller identity by looking up the session ID in a cookie in a session store.
+// The identity type is set to subject.
+//
+// If the cookie isn't present or the session isn't found, the request is considered anonymous. If the store returns
+// an error, the middleware rejects the request according to its `WithMappingFailure()` setting.
+func (b *IdentityBuilder) FromSession(cookie string, store httpmw.SessionStore) *IdentityBuilder {
+	return b.MapperE(func(c *fiber.Ctx, identity middleware.Identity) error {
+		sessionID := c.Cookies(cookie)
+		if sessionID == "" {
+			identity.None()
+			return nil
+		}
+
+		subject, err := store.Subject(c.UserContext(), strings.Clone(sessionID))
+		if err != nil {
+			return err
+		}
+
+		if subject == "" {
+			identity.None()
+			return nil
+		}
+
+		identity.Subject().ID(subject)
+
+		return nil
+	})
+}
+
+// FromLocal extracts caller identity from a value stored in the request's locals with `c.Locals(key, value)`.
+//
+// If the value is not present, not a string, or an empty string then the request is considered anonymous.
+func (b *IdentityBuilder) FromLocal(key interface{}) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		id, _ := c.Locals(key).(string)
+		identity.ID(id)
+	})
+}
+
+// FromContextValue extracts caller identity from a value in the request's user context (`c.UserContext()`).
+//
+// If the value is not present, not a string, or an empty string then the request is considered anonymous.
+func (b *IdentityBuilder) FromContextValue(key interface{}) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		identity.ID(internal.ValueOrEmpty(c.UserContext(), key))
+	})
+}
+
+// FromHostname extracts caller identity from the incoming request's host name.
+//
+// The function returns the specified hostname segment. Indexing is zero-based and starts from the left.
+// Negative indices start from the right.
+//
+// For Example, if the hostname is "service.user.company.com" then both FromHostname(1) and
+// FromHostname(-3) return the value "user".
+func (b *IdentityBuilder) FromHostname(segment int) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		hostname := c.Hostname()
+		if host, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = host
+		}
+
+		identity.ID(strings.Clone(internal.HostnameSegment(hostname, segment)))
+	})
+}
+
+// FromPeerCertificate extracts caller identity from the client certificate of requests received over mutual TLS.
+// The selector determines which certificate field identifies the caller. For example:
+//
+//  idBuilder.FromPeerCertificate(middleware.CommonName)
+//
+// The identity type is set to subject. If the caller didn't present a certificate or the selected field is empty, the
+// request is considered anonymous.
+func (b *IdentityBuilder) FromPeerCertificate(selector middleware.CertificateSelector) *IdentityBuilder {
+	return b.Mapper(func(c *fiber.Ctx, identity middleware.Identity) {
+		state := c.Context().TLSConnectionState()
+		if state == nil || len(state.PeerCertificates) == 0 {
+			identity.None()
+			return
+		}
+
+		identity.Subject().ID(selector(state.PeerCertificates[0]))
+	})
+}
+
+// FirstOf retrieves caller identity from an ordered list of sources. Each source is an IdentityBuilder with its own
+// identity type and source. The first source that yields an identity is used.
+// If none of the sources yield an identity, the request is considered anonymous.
+//
+// Sources that don't have an identity type use the type of the builder that FirstOf is called on.
+// Each source is verified and transformed with its own settings. The verifier of the builder that FirstOf is called on
+// only applies to tokens from sources that don't have one, and its transforms apply to subjects from any source.
+func (b *IdentityBuilder) FirstOf(sources ...*IdentityBuilder) *IdentityBuilder {
+	builders := make([]*internal.IdentityBuilder[*fiber.Ctx], len(sources))
+	for i, source := range sources {
+		builders[i] = &source.builder
+	}
+
+	b.builder.SetSources(builders...)
+
+	return b
+}
+
+// Transform adds functions that post-process the caller's identity before it is sent to the authorizer.
+// Transforms are applied in order, after JWT verification and subject extraction. They only apply to subject
+// identities; JWTs are sent unchanged.
+func (b *IdentityBuilder) Transform(transforms ...middleware.IdentityTransform) *IdentityBuilder {
+	b.builder.AddTransforms(transforms...)
+	return b
+}
+
+// Mapper takes a custom IdentityMapper to be used for extracting identity information from incoming requests.
+func (b *IdentityBuilder) Mapper(mapper IdentityMapper) *IdentityBuilder {
+	return b.MapperE(func(c *fiber.Ctx, identity middleware.Identity) error {
+		mapper(c, identity)
+		return nil
+	})
+}
+
+// MapperE takes a custom IdentityMapperE to be used for extracting identity information from incoming requests.
+// If the mapper returns an error, the middleware rejects the request according to its `WithMappingFailure()` setting.
+func (b *IdentityBuilder) MapperE(mapper IdentityMapperE) *IdentityBuilder {
+	b.builder.SetMapper(func(_ context.Context, c *fiber.Ctx, identity middleware.Identity) error {
+		return mapper(c, identity)
+	})
+
+	return b
+}
+
+// VerifyJWT instructs the builder to verify caller JWTs using the specified verifier.
+// Requests with invalid tokens are rejected with status 401 before the authorizer is called.
+//
+// If the identity type is subject, the verified token's subject is sent to the authorizer instead of the token.
+func (b *IdentityBuilder) VerifyJWT(verifier *middleware.JWTVerifier) *IdentityBuilder {
+	b.builder.SetVerifier(verifier)
+	return b
+}
+
+// Resolve constructs an IdentityContext that can be used in authorization requests.
+// If JWT verification is enabled, an error wrapping middleware.ErrUnauthenticated is returned for invalid tokens.
+func (b *IdentityBuilder) Resolve(c *fiber.Ctx) (*api.IdentityContext, error) {
+	return b.builder.Resolve(c.UserContext(), c)
+}
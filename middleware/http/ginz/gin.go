@@ -1,7 +1,6 @@
 package ginz
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/aserto-dev/aserto-go/middleware"
@@ -18,6 +17,26 @@ type (
 	AuthorizerClient = authorizer.AuthorizerClient
 )
 
+// AuthorizationResultKey is the gin context key under which the middleware stores the `*middleware.AuthorizationResult`
+// of allowed requests.
+const AuthorizationResultKey = "aserto.authorization_result"
+
+// AuthorizationResult returns the result of the authorization call made for a request, or false if the request
+// wasn't authorized by the middleware (e.g. because it is exempt).
+//
+// The result is also stored in the context of the request (`c.Request.Context()`) and can be retrieved with
+// `middleware.AuthorizationResultFromContext`.
+func AuthorizationResult(c *gin.Context) (*middleware.AuthorizationResult, bool) {
+	value, ok := c.Get(AuthorizationResultKey)
+	if !ok {
+		return nil, false
+	}
+
+	result, ok := value.(*middleware.AuthorizationResult)
+
+	return result, ok
+}
+
 /*
 Middleware implements middleware that can be added to routes in Gin servers.
 
@@ -35,10 +54,7 @@ type Middleware struct {
 	// Identity determines the caller identity used in authorization calls.
 	Identity *httpmw.IdentityBuilder
 
-	client         AuthorizerClient
-	policy         api.PolicyContext
-	policyMapper   StringMapper
-	resourceMapper StructMapper
+	authz internal.HTTPAuthorizer[*gin.Context]
 }
 
 type (
@@ -49,6 +65,9 @@ type (
 	// StructMapper functions are used to extract structured data from incoming requests.
 	// The optional resource mapper is a StructMapper.
 	StructMapper func(*gin.Context) *structpb.Struct
+
+	// StructMapperE is like StructMapper but can return an error if the resource can't be determined.
+	StructMapperE func(*gin.Context) (*structpb.Struct, error)
 )
 
 // New creates middleware for the specified policy.
@@ -57,44 +76,47 @@ type (
 // Those can be overridden using `Middleware.Identity` to specify the caller's identity, or using
 // the middleware's ".With...()" functions to set policy path and resource mappers.
 func New(client AuthorizerClient, policy Policy) *Middleware {
-	policyMapper := urlPolicyPathMapper("")
-	if policy.Path != "" {
-		policyMapper = nil
+	m := &Middleware{Identity: (&httpmw.IdentityBuilder{}).FromHeader("Authorization")}
+
+	m.authz = internal.HTTPAuthorizer[*gin.Context]{
+		Client:          client,
+		Policy:          internal.DefaultPolicyContext(policy),
+		Identity:        func(c *gin.Context) (*api.IdentityContext, error) { return m.Identity.Resolve(c.Request) },
+		ResourceMappers: []internal.ResourceMapper[*gin.Context]{pathParamsResourceMapper},
+		MaxBodySize:     internal.DefaultMaxBodySize,
 	}
 
-	return &Middleware{
-		client:         client,
-		Identity:       (&httpmw.IdentityBuilder{}).FromHeader("Authorization"),
-		policy:         *internal.DefaultPolicyContext(policy),
-		resourceMapper: defaultResourceMapper,
-		policyMapper:   policyMapper,
+	if policy.Path == "" {
+		m.authz.PolicyMapper = urlPolicyPathMapper("")
 	}
+
+	return m
 }
 
 // Handler is the middleware implementation. It is how an Authorizer is wired to a Gin router.
 func (m *Middleware) Handler(c *gin.Context) {
-	if m.policyMapper != nil {
-		m.policy.Path = m.policyMapper(c)
-	}
-
-	isRequest := authorizer.IsRequest{
-		IdentityContext: m.Identity.Build(c.Request),
-		PolicyContext:   &m.policy,
-		ResourceContext: m.resourceMapper(c),
-	}
-
-	resp, err := m.client.Is(
-		c,
-		&isRequest,
-	)
-	if err == nil && len(resp.Decisions) == 1 {
-		if resp.Decisions[0].Is {
-			c.Next()
-		} else {
-			c.AbortWithStatus(http.StatusForbidden)
+	decision := m.authz.Authorize(c, c, c.Request.Method, c.Request.URL.Path)
+
+	switch {
+	case decision.Allowed && decision.Result != nil:
+		c.Set(AuthorizationResultKey, decision.Result)
+		c.Request = c.Request.WithContext(
+			middleware.ContextWithAuthorizationResult(c.Request.Context(), decision.Result),
+		)
+		c.Next()
+	case decision.Allowed:
+		c.Next()
+	case decision.Problem != nil:
+		c.Data(decision.Status, internal.ProblemContentType, decision.Problem)
+		c.Abort()
+	case decision.Err != nil:
+		if decision.Challenge != "" {
+			c.Header("WWW-Authenticate", decision.Challenge)
 		}
-	} else {
-		c.AbortWithError(http.StatusInternalServerError, err) // nolint:errcheck
+
+		c.AbortWithError(decision.Status, decision.Err) // nolint:errcheck
+	default:
+		c.AbortWithStatus(decision.Status)
 	}
 }
 
@@ -112,46 +134,198 @@ func (m *Middleware) Handler(c *gin.Context) {
 // becomes the policy path
 //  "myapp.POST.products.__id"
 func (m *Middleware) WithPolicyFromURL(prefix string) *Middleware {
-	m.policyMapper = urlPolicyPathMapper(prefix)
+	m.authz.PolicyMapper = urlPolicyPathMapper(prefix)
 	return m
 }
 
 // WithPolicyPathMapper sets a custom policy mapper, a function that takes an incoming request
 // and returns the path within the policy of the package to query.
 func (m *Middleware) WithPolicyPathMapper(mapper StringMapper) *Middleware {
-	m.policyMapper = mapper
+	m.authz.PolicyMapper = mapper
 	return m
 }
 
 // WithNoResourceContext causes the middleware to include no resource context in authorization request instead
 // of the default behavior that sends all URL path parameters.
+//
+// Resource mappers added after WithNoResourceContext() are still applied.
 func (m *Middleware) WithNoResourceContext() *Middleware {
-	m.resourceMapper = func(*gin.Context) *structpb.Struct {
-		return nil
-	}
-
+	m.authz.ResourceMappers = nil
 	return m
 }
 
-// WithResourceMapper sets a custom resource mapper, a function that takes an incoming request
-// and returns the resource object to include with the authorization request as a `structpb.Struct`.
+// WithResourceMapper adds a custom resource mapper, a function that takes an incoming request
+// and returns resource fields as a `structpb.Struct`.
+//
+// Resource mappers are applied in the order they are added, starting with the default mapper that adds
+// route parameters. Their fields are merged into a single resource context according to the rule set with
+// `WithResourceConflict()`.
 func (m *Middleware) WithResourceMapper(mapper StructMapper) *Middleware {
-	m.resourceMapper = mapper
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		return mapper(c).AsMap(), nil
+	})
+}
+
+// WithResourceMapperE adds a custom resource mapper that can return an error. If it does, the request is rejected
+// according to the `WithMappingFailure()` setting.
+func (m *Middleware) WithResourceMapperE(mapper StructMapperE) *Middleware {
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		res, err := mapper(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.AsMap(), nil
+	})
+}
+
+// WithResourceFromContextValue adds the value associated with a key in the request context to the resource context,
+// under the specified field name.
+func (m *Middleware) WithResourceFromContextValue(ctxKey interface{}, field string) *Middleware {
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		value := c.Request.Context().Value(ctxKey)
+		if value == nil {
+			return nil, nil
+		}
+
+		return map[string]interface{}{field: value}, nil
+	})
+}
+
+// WithResourceFromBody adds fields from JSON request bodies to the resource context. Fields are selected using
+// dot-separated paths and keep their nesting in the resource context. For example:
+//
+//   mw.WithResourceFromBody("product.type", "quantity")
+//
+// adds the following fields to the resource context:
+//
+//   {
+//     "product": {"type": <value from body>},
+//     "quantity": <value from body>
+//   }
+//
+// Only bodies with a JSON content type are read. Bodies larger than the limit set with `WithMaxBodySize()` are
+// ignored. The body is buffered so handlers can still read it.
+func (m *Middleware) WithResourceFromBody(paths ...string) *Middleware {
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		return internal.BodyFields(c.Request, m.authz.MaxBodySize, paths), nil
+	})
+}
+
+// WithResourceFromQuery adds query string parameters to the resource context. Parameters with multiple values are
+// added as lists.
+func (m *Middleware) WithResourceFromQuery(params ...string) *Middleware {
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		return internal.QueryFields(c.Request, params), nil
+	})
+}
+
+// WithResourceFromHeaders adds the values of request headers to the resource context, keyed by header name.
+func (m *Middleware) WithResourceFromHeaders(headers ...string) *Middleware {
+	return m.addResourceMapper(func(c *gin.Context) (map[string]interface{}, error) {
+		return internal.HeaderFields(c.Request, headers), nil
+	})
+}
+
+// WithMaxBodySize sets the maximum number of bytes read from request bodies by `WithResourceFromBody()`.
+// The default is 1MiB.
+func (m *Middleware) WithMaxBodySize(bytes int64) *Middleware {
+	m.authz.MaxBodySize = bytes
 	return m
 }
 
-func defaultResourceMapper(c *gin.Context) *structpb.Struct {
+// WithMappingFailure sets how the middleware responds to requests for which a resource or identity mapper returns
+// an error. The default is `middleware.MappingFailureError`, which responds with status 500.
+func (m *Middleware) WithMappingFailure(failure middleware.MappingFailure) *Middleware {
+	m.authz.MappingFailure = failure
+	return m
+}
+
+// WithResourceConflict sets the rule used to combine fields with the same name from different resource mappers.
+// The default is `middleware.ResourceOverwrite`, where fields from later mappers replace those from earlier ones.
+func (m *Middleware) WithResourceConflict(conflict middleware.ResourceConflict) *Middleware {
+	m.authz.ResourceConflict = conflict
+	return m
+}
+
+func (m *Middleware) addResourceMapper(mapper internal.ResourceMapper[*gin.Context]) *Middleware {
+	m.authz.ResourceMappers = append(m.authz.ResourceMappers, mapper)
+	return m
+}
+
+// WithExemptRoute instructs the middleware to pass requests that match the specified HTTP method and URL path
+// pattern on to the next handler without authorizing them. This is useful for health checks, metrics endpoints,
+// CORS preflight requests, and other routes that don't require authorization.
+//
+// An empty method or "*" matches all HTTP methods.
+// In path patterns, '*' matches any sequence of characters within a single path segment and '**' matches any number
+// of segments.
+//
+// Example
+//
+//   mw.WithExemptRoute("GET", "/healthz").WithExemptRoute("OPTIONS", "/**")
+//
+// Exempt requests are still reported to hooks with the outcome `middleware.OutcomeExempt`.
+func (m *Middleware) WithExemptRoute(method, pattern string) *Middleware {
+	m.authz.ExemptRoutes = append(m.authz.ExemptRoutes, internal.RouteRule{Method: method, Pattern: pattern})
+	return m
+}
+
+// WithRoutePolicy instructs the middleware to evaluate the specified policy path for requests that match the HTTP
+// method and URL path pattern. Patterns are the same as in `WithExemptRoute()`. If policyPath is empty, the path
+// is determined by the middleware's policy mapper.
+//
+// Routes are tried in the order they are added and take precedence over the policy mapper.
+//
+// Example
+//
+//   mw.WithRoutePolicy("GET", "/products/*", "myapp.products.read").
+//     WithRoutePolicy("*", "/products/**", "myapp.products.write")
+func (m *Middleware) WithRoutePolicy(method, pattern, policyPath string) *Middleware {
+	m.authz.RoutePolicies = append(
+		m.authz.RoutePolicies,
+		internal.RouteRule{Method: method, Pattern: pattern, PolicyPath: policyPath},
+	)
+
+	return m
+}
+
+// WithDenyByDefault instructs the middleware to reject requests that have no explicit policy without sending them to
+// the authorizer. A request has an explicit policy if it matches a route set with `WithRoutePolicy()`. Policy paths
+// from the middleware's policy or a policy mapper, such as `WithPolicyFromURL()`, don't count. Exempt routes are never
+// rejected.
+//
+// The gRPC middleware applies the same rule to methods set with `WithMethodPolicies()` or annotations.
+func (m *Middleware) WithDenyByDefault() *Middleware {
+	m.authz.DenyByDefault = true
+	return m
+}
+
+// WithHook adds a function to be called with the outcome of each request handled by the middleware.
+// Hooks can be used to collect metrics or write audit logs.
+func (m *Middleware) WithHook(hook middleware.Hook) *Middleware {
+	m.authz.Hooks = append(m.authz.Hooks, hook)
+	return m
+}
+
+// WithDenialDetails instructs the middleware to respond to denied requests with an RFC 7807 problem details body
+// (content type "application/problem+json") that includes the evaluated policy path, the name of the decision that
+// was denied, and the policy's reason if it has one.
+//
+// If options.IncludeOutputs is set, the values of all rules in the policy are included as well.
+// Use options.Redact to remove sensitive information before details are sent to callers.
+func (m *Middleware) WithDenialDetails(options middleware.DenialDetailsOptions) *Middleware {
+	m.authz.DenialDetails = &options
+	return m
+}
+
+func pathParamsResourceMapper(c *gin.Context) (map[string]interface{}, error) {
 	vars := map[string]interface{}{}
 	for _, param := range c.Params {
 		vars[param.Key] = param.Value
 	}
 
-	res, err := structpb.NewStruct(vars)
-	if err != nil {
-		return nil
-	}
-
-	return res
+	return vars, nil
 }
 
 func urlPolicyPathMapper(prefix string) StringMapper {
@@ -0,0 +1,336 @@
+package ginz_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/http/ginz"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const DefaultPolicyPath = "policy.path"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newServer(handlers ...gin.HandlerFunc) *gin.Engine {
+	return newServerWithHandler(func(c *gin.Context) { c.Status(http.StatusOK) }, handlers...)
+}
+
+func newServerWithHandler(handler gin.HandlerFunc, middlewares ...gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.GET("/products/:id", append(middlewares, handler)...)
+	r.POST("/products/:id", append(middlewares, handler)...)
+
+	return r
+}
+
+func productResource(t *testing.T, fields map[string]interface{}) *structpb.Struct {
+	t.Helper()
+
+	resource := map[string]interface{}{"id": "123"}
+	for k, v := range fields {
+		resource[k] = v
+	}
+
+	res, err := structpb.NewStruct(resource)
+	require.NoError(t, err)
+
+	return res
+}
+
+func serve(r http.Handler, req *http.Request) *http.Response {
+	req.Header.Set("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+type tenantKey struct{}
+
+func TestResourceFromContextValue(t *testing.T) {
+	resource := productResource(t, map[string]interface{}{"tenant": "acme"})
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(resource))
+
+	mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+		WithResourceFromContextValue(tenantKey{}, "tenant")
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	tenant := func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), tenantKey{}, "acme"))
+	}
+
+	resp := serve(newServer(tenant, mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDenyByDefault(t *testing.T) {
+	t.Run("requests that match no route should be rejected", func(t *testing.T) {
+		mw := ginz.New(mock.New(t, nil), test.Policy("")).
+			WithRoutePolicy("GET", "/orders/*", "myapp.orders").
+			WithDenyByDefault()
+
+		resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("routes with a policy should be authorized", func(t *testing.T) {
+		expected := test.Request(test.PolicyPath("myapp.products"), test.Resource(productResource(t, nil)))
+
+		mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products").
+			WithDenyByDefault()
+
+		resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestRouteParams(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.GET.products.__id"), test.Resource(productResource(t, nil)))
+	mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithPolicyFromURL("myapp")
+
+	resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRouteRules(t *testing.T) {
+	t.Run("exempt routes should skip authorization", func(t *testing.T) {
+		var events []*middleware.Event
+
+		mw := ginz.New(mock.New(t, nil), test.Policy("")).
+			WithExemptRoute("GET", "/products/*").
+			WithHook(func(_ context.Context, event *middleware.Event) { events = append(events, event) })
+
+		resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, events, 1)
+		assert.Equal(t, middleware.OutcomeExempt, events[0].Outcome)
+		assert.Equal(t, "GET /products/123", events[0].Operation)
+	})
+
+	t.Run("route policies should override the policy path", func(t *testing.T) {
+		expected := test.Request(test.PolicyPath("myapp.products.write"), test.Resource(productResource(t, nil)))
+
+		mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products.read").
+			WithRoutePolicy("*", "/products/**", "myapp.products.write")
+
+		resp := serve(newServer(mw.Handler), httptest.NewRequest("POST", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestAuthorizationResult(t *testing.T) {
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(productResource(t, nil)))
+
+	var event *middleware.Event
+
+	mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+		WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+
+	var (
+		result  *middleware.AuthorizationResult
+		stored  bool
+		fromCtx bool
+	)
+
+	handler := func(c *gin.Context) {
+		result, stored = ginz.AuthorizationResult(c)
+		_, fromCtx = middleware.AuthorizationResultFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	}
+
+	resp := serve(newServerWithHandler(handler, mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, stored)
+	assert.True(t, fromCtx)
+	assert.Equal(t, expected.IdentityContext, result.Identity)
+	assert.Equal(t, DefaultPolicyPath, result.Policy.Path)
+	assert.Equal(t, middleware.OutcomeAllowed, event.Outcome)
+	assert.Equal(t, DefaultPolicyPath, event.PolicyPath)
+}
+
+func TestDenied(t *testing.T) {
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(productResource(t, nil)))
+
+	t.Run("denials should respond with 403", func(t *testing.T) {
+		var event *middleware.Event
+
+		mw := ginz.New(mock.New(t, expected, test.Decision(false)), test.Policy(DefaultPolicyPath)).
+			WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+
+		handler := func(c *gin.Context) {
+			t.Error("denied requests shouldn't reach the handler")
+		}
+
+		resp := serve(newServerWithHandler(handler, mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, middleware.OutcomeDenied, event.Outcome)
+	})
+
+	t.Run("denial details should be sent in the body", func(t *testing.T) {
+		outputs, err := structpb.NewStruct(map[string]interface{}{
+			"bindings": map[string]interface{}{
+				"outputs": map[string]interface{}{"allowed": false, "reason": "not an owner", "owner": "alice"},
+			},
+		})
+		require.NoError(t, err)
+
+		client := mock.New(t, expected, test.Decision(false))
+		client.QueryResponse = &authorizer.QueryResponse{Results: []*structpb.Struct{outputs}}
+
+		mw := ginz.New(client, test.Policy(DefaultPolicyPath)).WithDenialDetails(middleware.DenialDetailsOptions{
+			IncludeOutputs: true,
+			Redact: func(details *middleware.DenialDetails) {
+				delete(details.Outputs, "owner")
+			},
+		})
+
+		resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		assert.Equal(t, DefaultPolicyPath, body["policy_path"])
+		assert.Equal(t, test.DefaultDecision, body["decision"])
+		assert.Equal(t, "not an owner", body["detail"])
+		assert.Equal(t, map[string]interface{}{"allowed": false, "reason": "not an owner"}, body["outputs"])
+	})
+}
+
+func TestResourceFromRequest(t *testing.T) {
+	resource := productResource(t, map[string]interface{}{
+		"product":  map[string]interface{}{"type": "book"},
+		"quantity": float64(2),
+		"region":   "eu",
+		"tags":     []interface{}{"new", "sale"},
+		"X-Tenant": "acme",
+	})
+
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(resource))
+
+	mw := ginz.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+		WithResourceFromBody("product.type", "quantity", "missing.field").
+		WithResourceFromQuery("region", "tags", "missing").
+		WithResourceFromHeaders("X-Tenant")
+
+	body := `{"product": {"type": "book", "name": "Dune"}, "quantity": 2}`
+
+	var received string
+
+	handler := func(c *gin.Context) {
+		buf, err := io.ReadAll(c.Request.Body)
+		assert.NoError(t, err)
+
+		received = string(buf)
+
+		c.Status(http.StatusOK)
+	}
+
+	req := httptest.NewRequest("POST", "/products/123?region=eu&tags=new&tags=sale", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+
+	resp := serve(newServerWithHandler(handler, mw.Handler), req)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, received, "handlers should receive the full body")
+}
+
+func TestMappingFailure(t *testing.T) {
+	errMapper := errors.New("mapper error")
+
+	failingResource := func(*gin.Context) (*structpb.Struct, error) {
+		return nil, errMapper
+	}
+
+	tests := []struct {
+		name     string
+		failure  middleware.MappingFailure
+		status   int
+		outcome  middleware.Outcome
+		callback func(*ginz.Middleware)
+	}{
+		{
+			"resource mapper errors should respond with 500 by default",
+			middleware.MappingFailureError,
+			http.StatusInternalServerError,
+			middleware.OutcomeError,
+			func(mw *ginz.Middleware) { mw.WithResourceMapperE(failingResource) },
+		},
+		{
+			"resource mapper errors should respond with 400",
+			middleware.MappingFailureInvalidArgument,
+			http.StatusBadRequest,
+			middleware.OutcomeError,
+			func(mw *ginz.Middleware) { mw.WithResourceMapperE(failingResource) },
+		},
+		{
+			"identity mapper errors should be denied",
+			middleware.MappingFailureDeny,
+			http.StatusForbidden,
+			middleware.OutcomeDenied,
+			func(mw *ginz.Middleware) {
+				mw.Identity.MapperE(func(*http.Request, middleware.Identity) error {
+					return errMapper
+				})
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event *middleware.Event
+
+			mw := ginz.New(mock.New(t, nil), test.Policy(DefaultPolicyPath)).
+				WithMappingFailure(tc.failure).
+				WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+			tc.callback(mw)
+
+			resp := serve(newServer(mw.Handler), httptest.NewRequest("GET", "/products/123", nil))
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.outcome, event.Outcome)
+			assert.ErrorIs(t, event.Err, errMapper)
+		})
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Package gqlz provides field-level authorization for GraphQL servers built with gqlgen.
+
+Instead of authorizing each HTTP request once, the middleware authorizes individual fields, either with an
+`@aserto` schema directive or with a field middleware that checks every resolver. Decisions are memoized for the
+duration of an operation, so a field that is resolved many times (e.g. in a list) with the same identity and resource
+only results in one authorization call.
+
+The package doesn't depend on gqlgen. Its Directive and Field methods have the same signatures as gqlgen directives
+and field middleware, and the FieldMapper passed to New reads the field being resolved from gqlgen's field context:
+
+  authz := gqlz.New(client, policy, func(ctx context.Context) gqlz.Field {
+    fc := graphql.GetFieldContext(ctx)
+    field := gqlz.Field{Object: fc.Object, Name: fc.Field.Name, Args: fc.Args, IsResolver: fc.IsResolver}
+    if fc.Parent != nil {
+      field.Parent = fc.Parent.Result
+    }
+
+    return field
+  })
+
+  cfg := generated.Config{Resolvers: resolvers}
+  cfg.Directives.Aserto = func(
+    ctx context.Context, obj interface{}, next graphql.Resolver, path string, decision *string,
+  ) (interface{}, error) {
+    return authz.Directive(ctx, obj, next, path, decision)
+  }
+
+  srv := handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+  srv.AroundOperations(func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+    return next(gqlz.ContextWithDecisionCache(ctx))
+  })
+  srv.AroundFields(func(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+    return authz.Field(ctx, next)
+  })
+
+  http.Handle("/query", authz.Handler(srv))
+
+The directive is declared in the schema as:
+
+  directive @aserto(path: String!, decision: String) on FIELD_DEFINITION
+
+Only fields that have the directive or that are resolved by a resolver method are protected. Field() doesn't
+authorize fields that gqlgen reads from their parent objects (plain struct fields and map entries), so their values
+are returned to any caller that is allowed to resolve the parent. Protect sensitive fields by adding the directive to
+them or by generating resolvers for them (e.g. with `resolver: true` in gqlgen.yml).
+*/
+package gqlz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type (
+	Policy           = middleware.Policy
+	AuthorizerClient = authorizer.AuthorizerClient
+)
+
+var (
+	// ErrNoRequest is returned by resolvers called without the HTTP request in their context.
+	// Servers must be wrapped with `Middleware.Handler()`.
+	ErrNoRequest = errors.New("http request not found in context")
+
+	// ErrNoFieldMapper is returned by Field() if the middleware was created without a FieldMapper.
+	ErrNoFieldMapper = errors.New("field mapper not set")
+)
+
+// Field describes the GraphQL field being resolved.
+type Field struct {
+	// Object is the name of the type that the field belongs to (e.g. "Query").
+	Object string
+
+	// Name is the name of the field.
+	Name string
+
+	// Args holds the field's arguments.
+	Args map[string]interface{}
+
+	// Parent is the object that the field is resolved on. In gqlgen, it is the result of the parent field context,
+	// `graphql.GetFieldContext(ctx).Parent.Result`, which is nil for root fields.
+	// It is only used by Field(). Directives receive the parent object as an argument.
+	Parent interface{}
+
+	// IsResolver is true if the field is resolved by a resolver method rather than read from its parent object.
+	IsResolver bool
+}
+
+type (
+	// FieldMapper functions return the field being resolved.
+	FieldMapper func(context.Context) Field
+
+	// Resolver functions resolve the value of a field. They have the same signature as gqlgen's graphql.Resolver.
+	Resolver = func(context.Context) (interface{}, error)
+)
+
+/*
+Middleware authorizes the resolution of fields in GraphQL operations.
+
+To authorize fields, the middleware needs information about:
+
+1. The user making the request, read from the HTTP request using the Identity builder.
+
+2. The Aserto authorization policy to evaluate.
+
+3. The field's arguments and parent object, which are sent as the resource context.
+*/
+type Middleware struct {
+	// Identity determines the caller identity used in authorization calls.
+	Identity *httpmw.IdentityBuilder
+
+	client AuthorizerClient
+	policy api.PolicyContext
+	fields FieldMapper
+}
+
+// New creates middleware for the specified policy.
+//
+// The policy's path is the root of the paths evaluated by Field(). The field mapper returns the field being resolved.
+// It may be nil if only directives are used and they don't need field arguments, in which case Field() rejects all
+// fields.
+func New(client AuthorizerClient, policy Policy, fields FieldMapper) *Middleware {
+	return &Middleware{
+		client:   client,
+		Identity: (&httpmw.IdentityBuilder{}).FromHeader("Authorization"),
+		policy:   *internal.DefaultPolicyContext(policy),
+		fields:   fields,
+	}
+}
+
+type (
+	requestKey       struct{}
+	decisionCacheKey struct{}
+)
+
+// Handler wraps a GraphQL server so that resolvers can read the caller's identity from the HTTP request.
+// It also adds a decision cache to requests that don't get one for each operation with ContextWithDecisionCache.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestKey{}, r)
+		next.ServeHTTP(w, r.WithContext(ContextWithDecisionCache(ctx)))
+	})
+}
+
+// ContextWithDecisionCache returns a context in which authorization decisions are memoized. Decisions are cached by
+// policy path, decision, identity and resource.
+//
+// It is meant to be called once per operation, for example in gqlgen's `AroundOperations()`.
+func ContextWithDecisionCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decisionCacheKey{}, &decisionCache{entries: map[string]*cachedDecision{}})
+}
+
+// Directive implements the `@aserto(path: String!, decision: String)` directive. It authorizes the field using the
+// specified policy path and decision, or the middleware's decision if none is specified.
+//
+// The resource context holds the field's arguments under "args" and the object the field is resolved on under "parent".
+func (m *Middleware) Directive(
+	ctx context.Context,
+	obj interface{},
+	next Resolver,
+	path string,
+	decision *string,
+) (interface{}, error) {
+	var args map[string]interface{}
+	if m.fields != nil {
+		args = m.fields(ctx).Args
+	}
+
+	decisions := m.policy.Decisions
+	if decision != nil && *decision != "" {
+		decisions = []string{*decision}
+	}
+
+	ctx, err := m.authorize(ctx, &api.PolicyContext{Id: m.policy.Id, Path: path, Decisions: decisions}, args, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return next(ctx)
+}
+
+// Field is a field middleware that authorizes every field resolved by a resolver method. Fields that are read from
+// their parent objects are NOT authorized and are resolved unchecked; see the package documentation. If the
+// middleware has no FieldMapper, Field returns ErrNoFieldMapper without resolving the field.
+//
+// The policy path is the field's type and name, under the middleware's policy path. For example, with policy path
+// "myapp", the field "order" of the "Query" type is authorized using the path "myapp.Query.order".
+// The resource context holds the field's arguments under "args" and the object the field is resolved on under "parent".
+func (m *Middleware) Field(ctx context.Context, next Resolver) (interface{}, error) {
+	if m.fields == nil {
+		return nil, ErrNoFieldMapper
+	}
+
+	field := m.fields(ctx)
+	if !field.IsResolver {
+		return next(ctx)
+	}
+
+	path := strings.Join([]string{field.Object, field.Name}, ".")
+	if m.policy.Path != "" {
+		path = strings.Trim(m.policy.Path, ".") + "." + path
+	}
+
+	policy := &api.PolicyContext{Id: m.policy.Id, Path: path, Decisions: m.policy.Decisions}
+
+	ctx, err := m.authorize(ctx, policy, field.Args, field.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	return next(ctx)
+}
+
+// authorize checks whether the field can be resolved and returns ctx with the authorization result.
+func (m *Middleware) authorize(
+	ctx context.Context,
+	policy *api.PolicyContext,
+	args map[string]interface{},
+	parent interface{},
+) (context.Context, error) {
+	r, ok := ctx.Value(requestKey{}).(*http.Request)
+	if !ok {
+		return ctx, ErrNoRequest
+	}
+
+	identity, err := m.Identity.Resolve(r)
+	if err != nil {
+		return ctx, err
+	}
+
+	resource, err := resourceContext(args, parent)
+	if err != nil {
+		return ctx, err
+	}
+
+	req := &authorizer.IsRequest{IdentityContext: identity, PolicyContext: policy, ResourceContext: resource}
+
+	result, err := m.cachedIs(ctx, req)
+	if err != nil {
+		return ctx, err
+	}
+
+	if !result.Decisions[0].Is {
+		return ctx, cerr.ErrAuthorizationFailed
+	}
+
+	return middleware.ContextWithAuthorizationResult(ctx, result), nil
+}
+
+// cachedIs calls the authorizer, or returns the memoized result of an identical call made in the same operation.
+// Only successful calls are memoized. Concurrent identical calls wait for the first one, and retry with their own
+// context if it fails.
+func (m *Middleware) cachedIs(ctx context.Context, req *authorizer.IsRequest) (*middleware.AuthorizationResult, error) {
+	cache, ok := ctx.Value(decisionCacheKey{}).(*decisionCache)
+	if !ok {
+		return m.is(ctx, req)
+	}
+
+	key, err := cacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := cache.entry(key)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.result == nil {
+		result, err := m.is(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.result = result
+	}
+
+	return entry.result, nil
+}
+
+func (m *Middleware) is(ctx context.Context, req *authorizer.IsRequest) (*middleware.AuthorizationResult, error) {
+	result, err := internal.Is(ctx, m.client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "authorization call failed")
+	}
+
+	if len(result.Decisions) != 1 {
+		return nil, cerr.ErrInvalidDecision
+	}
+
+	return result, nil
+}
+
+type decisionCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedDecision
+}
+
+type cachedDecision struct {
+	mu     sync.Mutex
+	result *middleware.AuthorizationResult
+}
+
+func (c *decisionCache) entry(key string) *cachedDecision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedDecision{}
+		c.entries[key] = entry
+	}
+
+	return entry
+}
+
+func cacheKey(req *authorizer.IsRequest) (string, error) {
+	key, err := json.Marshal([]interface{}{
+		req.IdentityContext.Type,
+		req.IdentityContext.Identity,
+		req.PolicyContext.Path,
+		req.PolicyContext.Decisions,
+		req.ResourceContext.AsMap(),
+	})
+
+	return string(key), err
+}
+
+// resourceContext returns a resource with the field's arguments under "args" and its parent object under "parent".
+// Keeping them apart means that arguments can't shadow the parent object. Values are converted to their JSON
+// representation.
+func resourceContext(args map[string]interface{}, parent interface{}) (*structpb.Struct, error) {
+	fields := map[string]interface{}{}
+	if len(args) > 0 {
+		fields["args"] = args
+	}
+
+	if parent != nil {
+		fields["parent"] = parent
+	}
+
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert resource")
+	}
+
+	var resource map[string]interface{}
+	if err := json.Unmarshal(buf, &resource); err != nil {
+		return nil, errors.Wrap(err, "failed to convert resource")
+	}
+
+	return structpb.NewStruct(resource)
+}
@@ -0,0 +1,250 @@
+package gqlz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware/http/gqlz"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type countingClient struct {
+	authorizer.AuthorizerClient
+	calls int
+}
+
+func (c *countingClient) Is(
+	ctx context.Context,
+	in *authorizer.IsRequest,
+	opts ...grpc.CallOption,
+) (*authorizer.IsResponse, error) {
+	c.calls++
+	return c.AuthorizerClient.Is(ctx, in, opts...)
+}
+
+type fieldKey struct{}
+
+func withField(ctx context.Context, field gqlz.Field) context.Context {
+	return context.WithValue(ctx, fieldKey{}, field)
+}
+
+func currentField(ctx context.Context) gqlz.Field {
+	field, _ := ctx.Value(fieldKey{}).(gqlz.Field)
+	return field
+}
+
+type order struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+}
+
+func resolved(ctx context.Context) (interface{}, error) {
+	return "resolved", nil
+}
+
+// serve runs fn as the handler of a request made by the default user and returns its result.
+func serve(t *testing.T, mw *gqlz.Middleware, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	t.Helper()
+
+	var (
+		result interface{}
+		err    error
+	)
+
+	h := mw.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		result, err = fn(r.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/query", nil)
+	req.Header.Set("Authorization", test.DefaultUsername)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	return result, err
+}
+
+func TestDirective(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"args":   map[string]interface{}{"id": "42", "parent": "7"},
+		"parent": map[string]interface{}{"id": "1", "owner": "alice"},
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(
+		test.PolicyPath("myapp.orders.get"),
+		test.WithDecision("can_read"),
+		test.Resource(resource),
+	)
+	client := &countingClient{AuthorizerClient: mock.New(t, expected, test.Decision(true))}
+	mw := gqlz.New(client, test.Policy("myapp"), currentField)
+
+	decision := "can_read"
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		args := map[string]interface{}{"id": "42", "parent": "7"}
+		ctx = withField(ctx, gqlz.Field{Object: "Order", Name: "item", Args: args})
+
+		parent := &order{ID: "1", Owner: "alice"}
+
+		var (
+			result interface{}
+			err    error
+		)
+
+		for i := 0; i < 3; i++ {
+			if result, err = mw.Directive(ctx, parent, resolved, "myapp.orders.get", &decision); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "resolved", result)
+	assert.Equal(t, 1, client.calls, "decisions should be memoized within an operation")
+}
+
+// failingClient fails the first authorization call.
+type failingClient struct {
+	authorizer.AuthorizerClient
+	failed bool
+}
+
+func (c *failingClient) Is(
+	ctx context.Context,
+	in *authorizer.IsRequest,
+	opts ...grpc.CallOption,
+) (*authorizer.IsResponse, error) {
+	if !c.failed {
+		c.failed = true
+		return nil, context.Canceled
+	}
+
+	return c.AuthorizerClient.Is(ctx, in, opts...)
+}
+
+func TestFailedCallsNotMemoized(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.orders.get"))
+	client := &failingClient{AuthorizerClient: mock.New(t, expected, test.Decision(true))}
+	mw := gqlz.New(client, test.Policy("myapp"), nil)
+
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		if _, err := mw.Directive(ctx, nil, resolved, "myapp.orders.get", nil); !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+
+		return mw.Directive(ctx, nil, resolved, "myapp.orders.get", nil)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "resolved", result)
+}
+
+func TestField(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"args": map[string]interface{}{"id": "42"}})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.Query.order"), test.Resource(resource))
+	client := &countingClient{AuthorizerClient: mock.New(t, expected, test.Decision(true))}
+	mw := gqlz.New(client, test.Policy("myapp"), currentField)
+
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		field := gqlz.Field{Object: "Query", Name: "order", Args: map[string]interface{}{"id": "42"}, IsResolver: true}
+		if _, err := mw.Field(withField(ctx, field), resolved); err != nil {
+			return nil, err
+		}
+
+		// Fields that aren't resolvers are not authorized.
+		return mw.Field(withField(ctx, gqlz.Field{Object: "Order", Name: "owner"}), resolved)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "resolved", result)
+	assert.Equal(t, 1, client.calls)
+}
+
+// fieldContext has the fields of gqlgen's graphql.FieldContext that are read by fieldContextMapper.
+type fieldContext struct {
+	Parent     *fieldContext
+	Object     string
+	Name       string
+	Args       map[string]interface{}
+	IsResolver bool
+	Result     interface{}
+}
+
+type fieldContextKey struct{}
+
+// fieldContextMapper reads fields the same way as a mapper that uses graphql.GetFieldContext().
+func fieldContextMapper(ctx context.Context) gqlz.Field {
+	fc, _ := ctx.Value(fieldContextKey{}).(*fieldContext)
+	field := gqlz.Field{Object: fc.Object, Name: fc.Name, Args: fc.Args, IsResolver: fc.IsResolver}
+
+	if fc.Parent != nil {
+		field.Parent = fc.Parent.Result
+	}
+
+	return field
+}
+
+func TestFieldParent(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"parent": map[string]interface{}{"id": "1", "owner": "alice"},
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.Order.invoice"), test.Resource(resource))
+	mw := gqlz.New(mock.New(t, expected, test.Decision(true)), test.Policy("myapp"), fieldContextMapper)
+
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		parent := &fieldContext{Object: "Query", Name: "order", Result: &order{ID: "1", Owner: "alice"}}
+		fc := &fieldContext{Parent: parent, Object: "Order", Name: "invoice", IsResolver: true}
+
+		return mw.Field(context.WithValue(ctx, fieldContextKey{}, fc), resolved)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "resolved", result)
+}
+
+func TestFieldWithoutMapper(t *testing.T) {
+	mw := gqlz.New(mock.New(t, nil), test.Policy("myapp"), nil)
+
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		return mw.Field(ctx, func(context.Context) (interface{}, error) {
+			t.Error("fields shouldn't be resolved without a field mapper")
+			return nil, nil
+		})
+	})
+
+	assert.ErrorIs(t, err, gqlz.ErrNoFieldMapper)
+	assert.Nil(t, result)
+}
+
+func TestDenied(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.Query.orders"))
+	mw := gqlz.New(mock.New(t, expected, test.Decision(false)), test.Policy("myapp"), currentField)
+
+	result, err := serve(t, mw, func(ctx context.Context) (interface{}, error) {
+		return mw.Field(withField(ctx, gqlz.Field{Object: "Query", Name: "orders", IsResolver: true}), resolved)
+	})
+
+	assert.ErrorIs(t, err, cerr.ErrAuthorizationFailed)
+	assert.Nil(t, result)
+}
+
+func TestNoRequest(t *testing.T) {
+	mw := gqlz.New(mock.New(t, nil), test.Policy("myapp"), nil)
+
+	_, err := mw.Directive(context.Background(), nil, resolved, "myapp.orders.get", nil)
+	assert.ErrorIs(t, err, gqlz.ErrNoRequest)
+}
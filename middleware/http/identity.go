@@ -1,24 +1,24 @@
 package http
 
 import (
+	"context"
 	"net/http"
-	"strings"
 
 	"github.com/aserto-dev/aserto-go/middleware"
 	"github.com/aserto-dev/aserto-go/middleware/internal"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
-	"github.com/lestrrat-go/jwx/jwt"
 )
 
 // IdentityMapper is the type of callback functions that can inspect incoming HTTP requests
 // and set the caller's identity.
 type IdentityMapper func(*http.Request, middleware.Identity)
 
+// IdentityMapperE is like IdentityMapper but can return an error if the caller's identity can't be determined.
+type IdentityMapperE func(*http.Request, middleware.Identity) error
+
 // IdentityBuilder is used to configure what information about caller identity is sent in authorization calls.
 type IdentityBuilder struct {
-	identityType    api.IdentityType
-	defaultIdentity string
-	mapper          IdentityMapper
+	builder internal.IdentityBuilder[*http.Request]
 }
 
 // Static values
@@ -30,7 +30,7 @@ type IdentityBuilder struct {
 //
 //  idBuilder.JWT().FromHeader("Authorization")
 func (b *IdentityBuilder) JWT() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_JWT
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_JWT)
 	return b
 }
 
@@ -41,23 +41,21 @@ func (b *IdentityBuilder) JWT() *IdentityBuilder {
 //
 //  idBuilder.Subject().FromContextValue("username")
 func (b *IdentityBuilder) Subject() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_SUB
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_SUB)
 	return b
 }
 
 // Call None() to indicate that requests are unauthenticated.
 func (b *IdentityBuilder) None() *IdentityBuilder {
-	b.identityType = api.IdentityType_IDENTITY_TYPE_NONE
-	b.defaultIdentity = ""
-
+	b.builder.None()
 	return b
 }
 
-// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, IdentityMapper
-// tries to infer whether the specified identity is a JWT or not.
+// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, the identity type
+// is inferred from the identity: values that parse as JWTs are sent as JWTs and other values as subjects.
 // Passing an empty string is the same as calling .None() and results in an authorization check for anonymous access.
 func (b *IdentityBuilder) ID(identity string) *IdentityBuilder {
-	b.defaultIdentity = identity
+	b.builder.SetID(identity)
 	return b
 }
 
@@ -65,19 +63,15 @@ func (b *IdentityBuilder) ID(identity string) *IdentityBuilder {
 //
 // Headers are attempted in order. The first non-empty header is used.
 // If none of the specified headers have a value, the request is considered anonymous.
+// The "Bearer" authentication scheme is removed from the value of the Authorization header.
 func (b *IdentityBuilder) FromHeader(header ...string) *IdentityBuilder {
-	b.mapper = func(r *http.Request, identity middleware.Identity) {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
 		for _, h := range header {
-			id := r.Header.Get(h)
+			id := internal.IdentityValue(h, r.Header.Get(h))
 			if id == "" {
 				continue
 			}
 
-			if h == "Authorization" {
-				// Authorization header is special. Need to remove "Bearer" auth scheme.
-				id = b.fromAuthzHeader(id)
-			}
-
 			identity.ID(id)
 
 			return
@@ -85,20 +79,40 @@ func (b *IdentityBuilder) FromHeader(header ...string) *IdentityBuilder {
 
 		// None of the specified headers are present in the request.
 		identity.None()
-	}
-
-	return b
+	})
 }
 
 // FromContextValue extracts caller identity from a value in the incoming request context.
 //
 // If the value is not present, not a string, or an empty string then the request is considered anonymous.
 func (b *IdentityBuilder) FromContextValue(key interface{}) *IdentityBuilder {
-	b.mapper = func(r *http.Request, identity middleware.Identity) {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
 		identity.ID(internal.ValueOrEmpty(r.Context(), key))
-	}
+	})
+}
 
-	return b
+// FromAuthorizationResult uses the identity that authorization middleware sent to the authorizer for the incoming
+// request that the request's context belongs to (see `middleware.IdentityFromContext()`). It is used to authorize
+// outgoing requests made on behalf of the caller.
+//
+// If the context holds no authorization result, the request is considered anonymous.
+func (b *IdentityBuilder) FromAuthorizationResult() *IdentityBuilder {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
+		id, ok := middleware.IdentityFromContext(r.Context())
+		if !ok || id == nil {
+			identity.None()
+			return
+		}
+
+		switch id.Type {
+		case api.IdentityType_IDENTITY_TYPE_JWT:
+			identity.JWT().ID(id.Identity)
+		case api.IdentityType_IDENTITY_TYPE_SUB:
+			identity.Subject().ID(id.Identity)
+		default:
+			identity.None()
+		}
+	})
 }
 
 // FromHostname extracts caller identity from the incoming request's host name.
@@ -109,55 +123,106 @@ func (b *IdentityBuilder) FromContextValue(key interface{}) *IdentityBuilder {
 // For Example, if the hostname is "service.user.company.com" then both FromHostname(1) and
 // FromHostname(-3) return the value "user".
 func (b *IdentityBuilder) FromHostname(segment int) *IdentityBuilder {
-	b.mapper = func(r *http.Request, identity middleware.Identity) {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
 		hostname := r.URL.Hostname()
-		identity.ID(hostnameSegment(hostname, segment))
+		identity.ID(internal.HostnameSegment(hostname, segment))
+	})
+}
+
+// FromPeerCertificate extracts caller identity from the client certificate of requests received over mutual TLS.
+// The selector determines which certificate field identifies the caller. For example:
+//
+//  idBuilder.FromPeerCertificate(middleware.CommonName)
+//
+// The identity type is set to subject. If the caller didn't present a certificate or the selected field is empty, the
+// request is considered anonymous.
+func (b *IdentityBuilder) FromPeerCertificate(selector middleware.CertificateSelector) *IdentityBuilder {
+	return b.Mapper(func(r *http.Request, identity middleware.Identity) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			identity.None()
+			return
+		}
+
+		identity.Subject().ID(selector(r.TLS.PeerCertificates[0]))
+	})
+}
+
+// FirstOf retrieves caller identity from an ordered list of sources. Each source is an IdentityBuilder with its own
+// identity type and source. The first source that yields an identity is used.
+// If none of the sources yield an identity, the request is considered anonymous.
+//
+// For example, to read a JWT from the Authorization header or, if it's missing, a username from the request context:
+//
+//  idBuilder.FirstOf(
+//    (&IdentityBuilder{}).JWT().FromHeader("Authorization"),
+//    (&IdentityBuilder{}).Subject().FromContextValue("username"),
+//  )
+//
+// Sources that don't have an identity type use the type of the builder that FirstOf is called on.
+// Each source is verified and transformed with its own settings. The verifier of the builder that FirstOf is called on
+// only applies to tokens from sources that don't have one, and its transforms apply to subjects from any source.
+func (b *IdentityBuilder) FirstOf(sources ...*IdentityBuilder) *IdentityBuilder {
+	builders := make([]*internal.IdentityBuilder[*http.Request], len(sources))
+	for i, source := range sources {
+		builders[i] = &source.builder
 	}
 
+	b.builder.SetSources(builders...)
+
 	return b
 }
 
-// Mapper takes a custom IdentityMapper to be used for extracting identity information from incomign requests.
-func (b *IdentityBuilder) Mapper(mapper IdentityMapper) *IdentityBuilder {
-	b.mapper = mapper
+// Transform adds functions that post-process the caller's identity before it is sent to the authorizer.
+// Transforms are applied in order, after JWT verification and subject extraction. They only apply to subject
+// identities; JWTs are sent unchanged. For example:
+//
+//  idBuilder.Subject().FromHeader("X-User-Email").Transform(middleware.Lowercase)
+func (b *IdentityBuilder) Transform(transforms ...middleware.IdentityTransform) *IdentityBuilder {
+	b.builder.AddTransforms(transforms...)
 	return b
 }
 
-// Build constructs an IdentityContext that can be used in authorization requests.
-func (b *IdentityBuilder) Build(r *http.Request) *api.IdentityContext {
-	identity := internal.NewIdentity(b.identityType, b.defaultIdentity)
-
-	if b.mapper != nil {
-		b.mapper(r, identity)
-	}
-
-	return identity.Context()
+// Mapper takes a custom IdentityMapper to be used for extracting identity information from incomign requests.
+func (b *IdentityBuilder) Mapper(mapper IdentityMapper) *IdentityBuilder {
+	return b.MapperE(func(r *http.Request, identity middleware.Identity) error {
+		mapper(r, identity)
+		return nil
+	})
 }
 
-func (b *IdentityBuilder) fromAuthzHeader(value string) string {
-	// Authorization header is special. Need to remove "Bearer" auth scheme.
-	value = strings.TrimSpace(strings.TrimPrefix(value, "Bearer"))
-	if b.identityType == api.IdentityType_IDENTITY_TYPE_SUB {
-		// Try to parse subject out of token
-		token, err := jwt.ParseString(value)
-		if err == nil {
-			value = token.Subject()
-		}
-	}
+// MapperE takes a custom IdentityMapperE to be used for extracting identity information from incoming requests.
+// If the mapper returns an error, the middleware rejects the request according to its `WithMappingFailure()` setting.
+func (b *IdentityBuilder) MapperE(mapper IdentityMapperE) *IdentityBuilder {
+	b.builder.SetMapper(func(_ context.Context, r *http.Request, identity middleware.Identity) error {
+		return mapper(r, identity)
+	})
 
-	return value
+	return b
 }
 
-func hostnameSegment(hostname string, level int) string {
-	parts := strings.Split(hostname, ".")
-
-	if level < 0 {
-		level += len(parts)
-	}
+// VerifyJWT instructs the builder to verify caller JWTs using the specified verifier.
+// Requests with invalid tokens are rejected with status 401 before the authorizer is called.
+//
+// If the identity type is subject, the verified token's subject is sent to the authorizer instead of the token:
+//
+//  idBuilder.Subject().FromHeader("Authorization").VerifyJWT(verifier)
+//
+// Otherwise, the token is sent as a JWT identity.
+func (b *IdentityBuilder) VerifyJWT(verifier *middleware.JWTVerifier) *IdentityBuilder {
+	b.builder.SetVerifier(verifier)
+	return b
+}
 
-	if level >= 0 && level < len(parts) {
-		return parts[level]
-	}
+// Build constructs an IdentityContext that can be used in authorization requests.
+//
+// If JWT verification is enabled and the caller's token is invalid, or if the identity mapper fails, Build returns an
+// anonymous identity. Use Resolve to get the error.
+func (b *IdentityBuilder) Build(r *http.Request) *api.IdentityContext {
+	return b.builder.Build(r.Context(), r)
+}
 
-	return ""
+// Resolve constructs an IdentityContext that can be used in authorization requests.
+// If JWT verification is enabled, an error wrapping middleware.ErrUnauthenticated is returned for invalid tokens.
+func (b *IdentityBuilder) Resolve(r *http.Request) (*api.IdentityContext, error) {
+	return b.builder.Resolve(r.Context(), r)
 }
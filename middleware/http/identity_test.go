@@ -1,8 +1,16 @@
 package http // nolint:testpackage  // testing unexported logic
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"google.golang.org/protobuf/testing/protocmp"
 	"gotest.tools/assert"
 )
 
@@ -29,7 +37,101 @@ func TestHostnameSegment(t *testing.T) {
 
 func hostnameSegmentTest(test TestCase) func(*testing.T) {
 	return func(t *testing.T) {
-		actual := hostnameSegment(test.hostname, test.level)
+		actual := internal.HostnameSegment(test.hostname, test.level)
 		assert.Equal(t, test.expected, actual)
 	}
 }
+
+func TestIdentityFirstOf(t *testing.T) {
+	builder := (&IdentityBuilder{}).FirstOf(
+		(&IdentityBuilder{}).JWT().FromHeader("Authorization"),
+		(&IdentityBuilder{}).Subject().FromHeader("X-User-Email"),
+	).Transform(middleware.Lowercase)
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.Header.Set("X-User-Email", "George@Example.com")
+
+	assert.DeepEqual(
+		t,
+		&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "george@example.com"},
+		builder.Build(req),
+		protocmp.Transform(),
+	)
+
+	req.Header.Set("Authorization", "Bearer token")
+
+	assert.DeepEqual(
+		t,
+		&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_JWT, Identity: "token"},
+		builder.Build(req),
+		protocmp.Transform(),
+	)
+}
+
+func cookieRequest(name, value string) *http.Request {
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.AddCookie(&http.Cookie{Name: name, Value: value})
+
+	return req
+}
+
+func subject(id string) *api.IdentityContext {
+	return &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: id}
+}
+
+func anonymous() *api.IdentityContext {
+	return &api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_NONE}
+}
+
+func TestIdentityFromCookie(t *testing.T) {
+	builder := (&IdentityBuilder{}).Subject().FromCookie("user")
+
+	assert.DeepEqual(t, subject("george"), builder.Build(cookieRequest("user", "george")), protocmp.Transform())
+	assert.DeepEqual(t, anonymous(), builder.Build(cookieRequest("other", "george")), protocmp.Transform())
+}
+
+func TestIdentityFromSignedCookie(t *testing.T) {
+	oldKey, newKey := []byte("old-key"), []byte("new-key")
+	builder := (&IdentityBuilder{}).Subject().FromSignedCookie("user", newKey, oldKey)
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected *api.IdentityContext
+	}{
+		{"should accept values signed with the current key", SignCookieValue(newKey, "george"), subject("george")},
+		{"should accept values signed with an old key", SignCookieValue(oldKey, "george"), subject("george")},
+		{"should reject unknown keys", SignCookieValue([]byte("other-key"), "george"), anonymous()},
+		{"should reject tampered values", "ringo" + SignCookieValue(newKey, "george")[6:], anonymous()},
+		{"should reject unsigned values", "george", anonymous()},
+	}
+
+	for _, test := range testCases {
+		assert.DeepEqual(t, test.expected, builder.Build(cookieRequest("user", test.value)), protocmp.Transform())
+	}
+}
+
+func TestIdentityFromSession(t *testing.T) {
+	errStore := errors.New("store unavailable")
+
+	store := SessionStoreFunc(func(_ context.Context, sessionID string) (string, error) {
+		switch sessionID {
+		case "session-id":
+			return "george", nil
+		case "broken":
+			return "", errStore
+		}
+
+		return "", nil
+	})
+
+	builder := (&IdentityBuilder{}).JWT().FromSession("session", store)
+
+	assert.DeepEqual(t, subject("george"), builder.Build(cookieRequest("session", "session-id")), protocmp.Transform())
+	assert.DeepEqual(t, anonymous(), builder.Build(cookieRequest("session", "expired")), protocmp.Transform())
+	assert.DeepEqual(t, anonymous(), builder.Build(httptest.NewRequest("GET", "/", nil)), protocmp.Transform())
+
+	_, err := builder.Resolve(cookieRequest("session", "broken"))
+	assert.Assert(t, internal.IsMapperError(err))
+	assert.Assert(t, errors.Is(err, errStore))
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/aserto-dev/aserto-go/middleware/internal"
 	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
-	"github.com/gorilla/mux"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -41,10 +40,8 @@ type Middleware struct {
 	// Identity determines the caller identity used in authorization calls.
 	Identity *httpmw.IdentityBuilder
 
-	client         AuthorizerClient
-	policy         api.PolicyContext
-	policyMapper   StringMapper
-	resourceMapper StructMapper
+	routeMappers []RouteMapper
+	authz        internal.HTTPAuthorizer[*http.Request]
 }
 
 type (
@@ -55,6 +52,9 @@ type (
 	// StructMapper functions are used to extract structured data from incoming requests.
 	// The optional resource mapper is a StructMapper.
 	StructMapper func(*http.Request) *structpb.Struct
+
+	// StructMapperE is like StructMapper but can return an error if the resource can't be determined.
+	StructMapperE func(*http.Request) (*structpb.Struct, error)
 )
 
 // New creates middleware for the specified policy.
@@ -63,44 +63,42 @@ type (
 // Those can be overridden using `Middleware.Identity` to specify the caller's identity, or using
 // the middleware's ".With...()" functions to set policy path and resource mappers.
 func New(client AuthorizerClient, policy Policy) *Middleware {
-	policyMapper := urlPolicyPathMapper("")
-	if policy.Path != "" {
-		policyMapper = nil
+	m := &Middleware{
+		Identity:     (&httpmw.IdentityBuilder{}).FromHeader("Authorization"),
+		routeMappers: defaultRouteMappers(),
+	}
+
+	m.authz = internal.HTTPAuthorizer[*http.Request]{
+		Client:          client,
+		Policy:          internal.DefaultPolicyContext(policy),
+		Identity:        func(r *http.Request) (*api.IdentityContext, error) { return m.Identity.Resolve(r) },
+		ResourceMappers: []internal.ResourceMapper[*http.Request]{m.pathParamsResourceMapper},
+		MaxBodySize:     internal.DefaultMaxBodySize,
 	}
 
-	return &Middleware{
-		client:         client,
-		Identity:       (&httpmw.IdentityBuilder{}).FromHeader("Authorization"),
-		policy:         *internal.DefaultPolicyContext(policy),
-		resourceMapper: defaultResourceMapper,
-		policyMapper:   policyMapper,
+	if policy.Path == "" {
+		m.authz.PolicyMapper = m.urlPolicyPathMapper("")
 	}
+
+	return m
 }
 
 // Handler is the middleware implementation. It is how an Authorizer is wired to an HTTP server.
 func (m *Middleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if m.policyMapper != nil {
-			m.policy.Path = m.policyMapper(r)
-		}
-
-		isRequest := authorizer.IsRequest{
-			IdentityContext: m.Identity.Build(r),
-			PolicyContext:   &m.policy,
-			ResourceContext: m.resourceMapper(r),
-		}
-		resp, err := m.client.Is(
-			r.Context(),
-			&isRequest,
-		)
-		if err == nil && len(resp.Decisions) == 1 {
-			if resp.Decisions[0].Is {
-				next.ServeHTTP(w, r)
-			} else {
-				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-			}
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		decision := m.authz.Authorize(r.Context(), r, r.Method, r.URL.Path)
+
+		switch {
+		case decision.Allowed && decision.Result != nil:
+			next.ServeHTTP(w, r.WithContext(middleware.ContextWithAuthorizationResult(r.Context(), decision.Result)))
+		case decision.Allowed:
+			next.ServeHTTP(w, r)
+		case decision.Problem != nil:
+			w.Header().Set("Content-Type", internal.ProblemContentType)
+			w.WriteHeader(decision.Status)
+			w.Write(decision.Problem) // nolint:errcheck
+		default:
+			writeError(w, decision)
 		}
 	})
 }
@@ -108,8 +106,10 @@ func (m *Middleware) Handler(next http.Handler) http.Handler {
 // WithPolicyFromURL instructs the middleware to construct the policy path from the path segment
 // of the incoming request's URL.
 //
-// Path separators ('/') are replaced with dots ('.'). If the request uses gorilla/mux to define path
-// parameters, those are added to the path with two leading underscores.
+// Path separators ('/') are replaced with dots ('.'). If the request was routed by a router recognized by the
+// middleware's route mappers (gorilla/mux and http.ServeMux patterns by default, see `WithRouteMappers()`) and the
+// route has path parameters, the route's template is used instead of the URL path, and parameters are added to the
+// path with two leading underscores.
 // An optional prefix can be specified to be included in all paths.
 //
 // Example
@@ -119,64 +119,228 @@ func (m *Middleware) Handler(next http.Handler) http.Handler {
 // becomes the policy path
 //  "myapp.POST.products.__id"
 func (m *Middleware) WithPolicyFromURL(prefix string) *Middleware {
-	m.policyMapper = urlPolicyPathMapper(prefix)
+	m.authz.PolicyMapper = m.urlPolicyPathMapper(prefix)
 	return m
 }
 
 // WithPolicyPathMapper sets a custom policy mapper, a function that takes an incoming request
 // and returns the path within the policy of the package to query.
 func (m *Middleware) WithPolicyPathMapper(mapper StringMapper) *Middleware {
-	m.policyMapper = mapper
+	m.authz.PolicyMapper = mapper
 	return m
 }
 
 // WithNoResourceContext causes the middleware to include no resource context in authorization request instead
 // of the default behavior that sends all URL path parameters.
+//
+// Resource mappers added after WithNoResourceContext() are still applied.
 func (m *Middleware) WithNoResourceContext() *Middleware {
-	m.resourceMapper = func(*http.Request) *structpb.Struct {
-		return nil
-	}
-
+	m.authz.ResourceMappers = nil
 	return m
 }
 
-// WithResourceMapper sets a custom resource mapper, a function that takes an incoming request
-// and returns the resource object to include with the authorization request as a `structpb.Struct`.
+// WithResourceMapper adds a custom resource mapper, a function that takes an incoming request
+// and returns resource fields as a `structpb.Struct`.
+//
+// Resource mappers are applied in the order they are added, starting with the default mapper that adds path parameters
+// of the request's route. Their fields are merged into a single resource context according to the rule set with
+// `WithResourceConflict()`.
 func (m *Middleware) WithResourceMapper(mapper StructMapper) *Middleware {
-	m.resourceMapper = mapper
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		return mapper(r).AsMap(), nil
+	})
+}
+
+// WithResourceMapperE adds a custom resource mapper that can return an error. If it does, the request is rejected
+// according to the `WithMappingFailure()` setting.
+func (m *Middleware) WithResourceMapperE(mapper StructMapperE) *Middleware {
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		res, err := mapper(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.AsMap(), nil
+	})
+}
+
+// WithResourceFromContextValue adds the value associated with a key in the request context to the resource context,
+// under the specified field name.
+func (m *Middleware) WithResourceFromContextValue(ctxKey interface{}, field string) *Middleware {
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		value := r.Context().Value(ctxKey)
+		if value == nil {
+			return nil, nil
+		}
+
+		return map[string]interface{}{field: value}, nil
+	})
+}
+
+// WithResourceFromBody adds fields from JSON request bodies to the resource context. Fields are selected using
+// dot-separated paths and keep their nesting in the resource context. For example:
+//
+//   mw.WithResourceFromBody("product.type", "quantity")
+//
+// adds the following fields to the resource context:
+//
+//   {
+//     "product": {"type": <value from body>},
+//     "quantity": <value from body>
+//   }
+//
+// Only bodies with a JSON content type are read. Bodies larger than the limit set with `WithMaxBodySize()` are
+// ignored. The body is buffered so handlers can still read it.
+func (m *Middleware) WithResourceFromBody(paths ...string) *Middleware {
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		return internal.BodyFields(r, m.authz.MaxBodySize, paths), nil
+	})
+}
+
+// WithResourceFromQuery adds query string parameters to the resource context. Parameters with multiple values are
+// added as lists.
+func (m *Middleware) WithResourceFromQuery(params ...string) *Middleware {
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		return internal.QueryFields(r, params), nil
+	})
+}
+
+// WithResourceFromHeaders adds the values of request headers to the resource context, keyed by header name.
+func (m *Middleware) WithResourceFromHeaders(headers ...string) *Middleware {
+	return m.addResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		return internal.HeaderFields(r, headers), nil
+	})
+}
+
+// WithMaxBodySize sets the maximum number of bytes read from request bodies by `WithResourceFromBody()`.
+// The default is 1MiB.
+func (m *Middleware) WithMaxBodySize(bytes int64) *Middleware {
+	m.authz.MaxBodySize = bytes
 	return m
 }
 
-func defaultResourceMapper(r *http.Request) *structpb.Struct {
-	vars := map[string]interface{}{}
-	for k, v := range mux.Vars(r) {
-		vars[k] = v
+// WithMappingFailure sets how the middleware responds to requests for which a resource or identity mapper returns
+// an error. The default is `middleware.MappingFailureError`, which responds with status 500.
+func (m *Middleware) WithMappingFailure(failure middleware.MappingFailure) *Middleware {
+	m.authz.MappingFailure = failure
+	return m
+}
+
+// WithResourceConflict sets the rule used to combine fields with the same name from different resource mappers.
+// The default is `middleware.ResourceOverwrite`, where fields from later mappers replace those from earlier ones.
+func (m *Middleware) WithResourceConflict(conflict middleware.ResourceConflict) *Middleware {
+	m.authz.ResourceConflict = conflict
+	return m
+}
+
+func (m *Middleware) addResourceMapper(mapper internal.ResourceMapper[*http.Request]) *Middleware {
+	m.authz.ResourceMappers = append(m.authz.ResourceMappers, mapper)
+	return m
+}
+
+// WithExemptRoute instructs the middleware to pass requests that match the specified HTTP method and URL path
+// pattern on to the next handler without authorizing them. This is useful for health checks, metrics endpoints,
+// CORS preflight requests, and other routes that don't require authorization.
+//
+// An empty method or "*" matches all HTTP methods.
+// In path patterns, '*' matches any sequence of characters within a single path segment and '**' matches any number
+// of segments.
+//
+// Example
+//
+//   mw.WithExemptRoute("GET", "/healthz").WithExemptRoute("OPTIONS", "/**")
+//
+// Exempt requests are still reported to hooks with the outcome `middleware.OutcomeExempt`.
+func (m *Middleware) WithExemptRoute(method, pattern string) *Middleware {
+	m.authz.ExemptRoutes = append(m.authz.ExemptRoutes, internal.RouteRule{Method: method, Pattern: pattern})
+	return m
+}
+
+// WithRoutePolicy instructs the middleware to evaluate the specified policy path for requests that match the HTTP
+// method and URL path pattern. Patterns are the same as in `WithExemptRoute()`. If policyPath is empty, the path
+// is determined by the middleware's policy mapper.
+//
+// Routes are tried in the order they are added and take precedence over the policy mapper.
+//
+// Example
+//
+//   mw.WithRoutePolicy("GET", "/products/*", "myapp.products.read").
+//     WithRoutePolicy("*", "/products/**", "myapp.products.write")
+func (m *Middleware) WithRoutePolicy(method, pattern, policyPath string) *Middleware {
+	m.authz.RoutePolicies = append(
+		m.authz.RoutePolicies,
+		internal.RouteRule{Method: method, Pattern: pattern, PolicyPath: policyPath},
+	)
+
+	return m
+}
+
+// WithDenyByDefault instructs the middleware to reject requests that have no explicit policy without sending them to
+// the authorizer. A request has an explicit policy if it matches a route set with `WithRoutePolicy()`. Policy paths
+// from the middleware's policy or a policy mapper, such as `WithPolicyFromURL()`, don't count. Exempt routes are never
+// rejected.
+//
+// The gRPC middleware applies the same rule to methods set with `WithMethodPolicies()` or annotations.
+func (m *Middleware) WithDenyByDefault() *Middleware {
+	m.authz.DenyByDefault = true
+	return m
+}
+
+// WithHook adds a function to be called with the outcome of each request handled by the middleware.
+// Hooks can be used to collect metrics or write audit logs.
+func (m *Middleware) WithHook(hook middleware.Hook) *Middleware {
+	m.authz.Hooks = append(m.authz.Hooks, hook)
+	return m
+}
+
+// WithDenialDetails instructs the middleware to respond to denied requests with an RFC 7807 problem details body
+// (content type "application/problem+json") that includes the evaluated policy path, the name of the decision that
+// was denied, and the policy's reason if it has one.
+//
+// If options.IncludeOutputs is set, the values of all rules in the policy are included as well.
+// Use options.Redact to remove sensitive information before details are sent to callers.
+func (m *Middleware) WithDenialDetails(options middleware.DenialDetailsOptions) *Middleware {
+	m.authz.DenialDetails = &options
+	return m
+}
+
+// writeError writes the response to a rejected request. Token errors aren't described to callers.
+func writeError(w http.ResponseWriter, decision *internal.HTTPDecision) {
+	if decision.Challenge != "" {
+		w.Header().Set("WWW-Authenticate", decision.Challenge)
+	}
+
+	message := http.StatusText(decision.Status)
+	if decision.Err != nil && decision.Status != http.StatusUnauthorized {
+		message = decision.Err.Error()
 	}
 
-	res, err := structpb.NewStruct(vars)
-	if err != nil {
-		return nil
+	http.Error(w, message, decision.Status)
+}
+
+// pathParamsResourceMapper adds the path parameters of the request's route to the resource context.
+func (m *Middleware) pathParamsResourceMapper(r *http.Request) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+
+	if route, ok := m.route(r); ok {
+		for k, v := range route.Params {
+			vars[k] = v
+		}
 	}
 
-	return res
+	return vars, nil
 }
 
-func urlPolicyPathMapper(prefix string) StringMapper {
+func (m *Middleware) urlPolicyPathMapper(prefix string) StringMapper {
 	return func(r *http.Request) string {
 		policyPath := []string{r.Method}
 
-		segments := getPathSegments(r)
-
-		if len(mux.Vars(r)) > 0 {
-			for i, segment := range segments {
-				if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
-					segments[i] = "__" + segment[1:len(segment)-1]
-				}
-			}
+		if route, ok := m.route(r); ok && route.Template != "" && len(route.Params) > 0 {
+			policyPath = append(policyPath, policySegments(route.Template)...)
+		} else {
+			policyPath = append(policyPath, strings.Split(strings.Trim(r.URL.Path, "/"), "/")...)
 		}
 
-		policyPath = append(policyPath, segments...)
-
 		if prefix != "" {
 			policyPath = append([]string{strings.Trim(prefix, ".")}, policyPath...)
 		}
@@ -184,18 +348,3 @@ func urlPolicyPathMapper(prefix string) StringMapper {
 		return strings.Join(policyPath, ".")
 	}
 }
-
-func getPathSegments(r *http.Request) []string {
-	path := r.URL.Path
-
-	if len(mux.Vars(r)) > 0 {
-		var err error
-
-		path, err = mux.CurrentRoute(r).GetPathTemplate()
-		if err != nil {
-			path = ""
-		}
-	}
-
-	return strings.Split(strings.Trim(path, "/"), "/")
-}
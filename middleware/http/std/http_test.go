@@ -1,13 +1,29 @@
 package std_test
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aserto-dev/aserto-go/middleware"
+	mw "github.com/aserto-dev/aserto-go/middleware/http"
 	httpmw "github.com/aserto-dev/aserto-go/middleware/http/std"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
 	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type TestCase struct {
@@ -112,3 +128,556 @@ func testCase(testCase *TestCase) func(*testing.T) {
 		assert.Equal(t, testCase.expectedStatusCode, resp.StatusCode)
 	}
 }
+
+func TestExemptRoute(t *testing.T) {
+	var events []*middleware.Event
+
+	mw := httpmw.New(mock.New(t, nil, test.Decision(false)), test.Policy("")).
+		WithExemptRoute("GET", "/healthz").
+		WithExemptRoute("OPTIONS", "/**").
+		WithHook(func(_ context.Context, event *middleware.Event) {
+			events = append(events, event)
+		})
+	handler := mw.Handler(http.HandlerFunc(noopHandler))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "https://example.com/healthz", nil),
+		httptest.NewRequest("OPTIONS", "https://example.com/api/products/123", nil),
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assert.Len(t, events, 2)
+
+	for _, event := range events {
+		assert.Equal(t, middleware.OutcomeExempt, event.Outcome)
+	}
+
+	assert.Equal(t, "OPTIONS /api/products/123", events[1].Operation)
+}
+
+func TestDenyByDefault(t *testing.T) {
+	serve := func(mw *httpmw.Middleware, target string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Authorization", test.DefaultUsername)
+
+		w := httptest.NewRecorder()
+		mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("requests that match no route should be rejected", func(t *testing.T) {
+		mw := httpmw.New(mock.New(t, nil), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products").
+			WithDenyByDefault()
+
+		assert.Equal(t, http.StatusForbidden, serve(mw, "https://example.com/foo"))
+	})
+
+	t.Run("paths from policy mappers shouldn't count as explicit policies", func(t *testing.T) {
+		mw := httpmw.New(mock.New(t, nil), test.Policy("")).
+			WithPolicyFromURL("myapp").
+			WithDenyByDefault()
+
+		assert.Equal(t, http.StatusForbidden, serve(mw, "https://example.com/foo"))
+	})
+
+	t.Run("routes with a policy should be authorized", func(t *testing.T) {
+		expected := test.Request(test.PolicyPath("myapp.products"))
+
+		mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+			WithRoutePolicy("GET", "/products/*", "myapp.products").
+			WithDenyByDefault()
+
+		assert.Equal(t, http.StatusOK, serve(mw, "https://example.com/products/123"))
+	})
+
+	t.Run("requests without a policy path should be rejected", func(t *testing.T) {
+		mw := httpmw.New(mock.New(t, nil), test.Policy("")).
+			WithPolicyPathMapper(func(*http.Request) string { return "" }).
+			WithRoutePolicy("", "/**", "").
+			WithDenyByDefault()
+
+		assert.Equal(t, http.StatusForbidden, serve(mw, "https://example.com/foo"))
+	})
+}
+
+func TestDenialDetails(t *testing.T) {
+	outputs, err := structpb.NewStruct(map[string]interface{}{
+		"bindings": map[string]interface{}{
+			"outputs": map[string]interface{}{"allowed": false, "reason": "not an owner", "owner": "alice"},
+		},
+	})
+	assert.NoError(t, err)
+
+	client := mock.New(t, test.Request(test.PolicyPath(DefaultPolicyPath)), test.Decision(false))
+	client.QueryResponse = &authorizer.QueryResponse{Results: []*structpb.Struct{outputs}}
+
+	mw := httpmw.New(client, test.Policy(DefaultPolicyPath)).WithDenialDetails(middleware.DenialDetailsOptions{
+		IncludeOutputs: true,
+		Redact: func(details *middleware.DenialDetails) {
+			delete(details.Outputs, "owner")
+		},
+	})
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+	req.Header.Add("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	assert.Equal(t, float64(http.StatusForbidden), body["status"])
+	assert.Equal(t, DefaultPolicyPath, body["policy_path"])
+	assert.Equal(t, test.DefaultDecision, body["decision"])
+	assert.Equal(t, "not an owner", body["detail"])
+	assert.Equal(t, map[string]interface{}{"allowed": false, "reason": "not an owner"}, body["outputs"])
+}
+
+func TestDenialReason(t *testing.T) {
+	outputs, err := structpb.NewStruct(map[string]interface{}{
+		"outputs": map[string]interface{}{"allowed": false, "reason": "not an owner"},
+	})
+	assert.NoError(t, err)
+
+	client := mock.New(t, test.Request(test.PolicyPath(DefaultPolicyPath)), test.Decision(false))
+	client.QueryResponse = &authorizer.QueryResponse{Results: []*structpb.Struct{outputs}}
+
+	mw := httpmw.New(client, test.Policy(DefaultPolicyPath)).WithDenialDetails(middleware.DenialDetailsOptions{})
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+	req.Header.Add("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	assert.Equal(t, "not an owner", body["reason"])
+	assert.NotContains(t, body, "outputs")
+}
+
+func TestAuthorizationResult(t *testing.T) {
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath))
+
+	mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	var (
+		result *middleware.AuthorizationResult
+		ok     bool
+	)
+
+	handler := mw.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		result, ok = middleware.AuthorizationResultFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+	req.Header.Add("Authorization", test.DefaultUsername)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, ok)
+	assert.Equal(t, expected.IdentityContext, result.Identity)
+	assert.Equal(t, DefaultPolicyPath, result.Policy.Path)
+	assert.Equal(t, []*authorizer.Decision{test.Decision(true)}, result.Decisions)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	jwks := test.NewJWKS(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := middleware.NewJWKSVerifier(
+		ctx,
+		jwks.URL,
+		middleware.JWTVerifierOptions{Issuer: test.Issuer, Audience: test.Audience},
+	)
+	require.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		expected int
+	}{
+		{"valid tokens should be allowed", jwks.Token(t, nil), http.StatusOK},
+		{"missing tokens should be anonymous", "", http.StatusOK},
+		{
+			"expired tokens should be rejected",
+			jwks.Token(t, map[string]interface{}{"exp": time.Now().Add(-time.Hour)}),
+			http.StatusUnauthorized,
+		},
+		{
+			"tokens from other issuers should be rejected",
+			jwks.Token(t, map[string]interface{}{"iss": "https://other.example.com"}),
+			http.StatusUnauthorized,
+		},
+		{
+			"tokens for other audiences should be rejected",
+			jwks.Token(t, map[string]interface{}{"aud": "https://other.example.com"}),
+			http.StatusUnauthorized,
+		},
+		{"tokens signed with unknown keys should be rejected", test.Sign(t, otherKey, nil), http.StatusUnauthorized},
+		{"malformed tokens should be rejected", "not-a-jwt", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := test.Request(test.PolicyPath(DefaultPolicyPath))
+			if tc.token == "" {
+				expected = test.Request(
+					test.PolicyPath(DefaultPolicyPath),
+					test.IdentityType(api.IdentityType_IDENTITY_TYPE_NONE),
+					test.Identity(""),
+				)
+			}
+
+			mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+			mw.Identity.Subject().FromHeader("Authorization").VerifyJWT(verifier)
+
+			req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+			if tc.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tc.token)
+			}
+
+			w := httptest.NewRecorder()
+			mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.expected, resp.StatusCode)
+
+			if tc.expected == http.StatusUnauthorized {
+				assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "invalid_token")
+			}
+		})
+	}
+}
+
+func TestFirstOfVerifyJWT(t *testing.T) {
+	jwks := test.NewJWKS(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := middleware.NewJWKSVerifier(ctx, jwks.URL, middleware.JWTVerifierOptions{Issuer: test.Issuer})
+	require.NoError(t, err)
+
+	store := mw.SessionStoreFunc(func(_ context.Context, sessionID string) (string, error) {
+		return "george", nil
+	})
+
+	token := jwks.Token(t, nil)
+
+	builders := map[string]func(*mw.IdentityBuilder){
+		"sources with verifiers": func(b *mw.IdentityBuilder) {
+			b.FirstOf(
+				(&mw.IdentityBuilder{}).JWT().FromHeader("Authorization").VerifyJWT(verifier),
+				(&mw.IdentityBuilder{}).FromSession("session", store),
+			)
+		},
+		"builder with verifier": func(b *mw.IdentityBuilder) {
+			b.FirstOf(
+				(&mw.IdentityBuilder{}).JWT().FromHeader("Authorization"),
+				(&mw.IdentityBuilder{}).FromSession("session", store),
+			).VerifyJWT(verifier)
+		},
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		session  string
+		expected *authorizer.IsRequest
+		status   int
+	}{
+		{
+			"verified tokens should be used",
+			token,
+			"session-id",
+			test.Request(
+				test.PolicyPath(DefaultPolicyPath),
+				test.IdentityType(api.IdentityType_IDENTITY_TYPE_JWT),
+				test.Identity(token),
+			),
+			http.StatusOK,
+		},
+		{
+			"sessions should be used without a token",
+			"",
+			"session-id",
+			test.Request(test.PolicyPath(DefaultPolicyPath), test.Identity("george")),
+			http.StatusOK,
+		},
+		{"invalid tokens should be rejected", "not-a-jwt", "session-id", nil, http.StatusUnauthorized},
+	}
+
+	for name, configure := range builders {
+		for _, tc := range tests {
+			t.Run(name+": "+tc.name, func(t *testing.T) {
+				m := httpmw.New(mock.New(t, tc.expected, test.Decision(true)), test.Policy(DefaultPolicyPath))
+				configure(m.Identity)
+
+				req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+				req.AddCookie(&http.Cookie{Name: "session", Value: tc.session})
+
+				if tc.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tc.token)
+				}
+
+				w := httptest.NewRecorder()
+				m.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+				resp := w.Result()
+				defer resp.Body.Close()
+
+				assert.Equal(t, tc.status, resp.StatusCode)
+			})
+		}
+	}
+}
+
+func TestResourceFromRequest(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"product":  map[string]interface{}{"type": "book"},
+		"quantity": float64(2),
+		"region":   "eu",
+		"tags":     []interface{}{"new", "sale"},
+		"X-Tenant": "acme",
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(resource))
+
+	mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+		WithResourceFromBody("product.type", "quantity", "missing.field").
+		WithResourceFromQuery("region", "tags", "missing").
+		WithResourceFromHeaders("X-Tenant")
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	body := `{"product": {"type": "book", "name": "Dune"}, "quantity": 2}`
+
+	var received string
+
+	handler := mw.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		buf, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		received = string(buf)
+	}))
+
+	req := httptest.NewRequest("POST", "https://example.com/foo?region=eu&tags=new&tags=sale", strings.NewReader(body))
+	req.Header.Set("Authorization", test.DefaultUsername)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, received, "handlers should receive the full body")
+}
+
+func TestMaxBodySize(t *testing.T) {
+	expected := test.Request(test.PolicyPath(DefaultPolicyPath))
+
+	mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+		WithResourceFromBody("quantity").
+		WithMaxBodySize(8)
+	mw.Identity.Subject().ID(test.DefaultUsername)
+
+	body := `{"quantity": 2}`
+
+	var received string
+
+	handler := mw.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		buf, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		received = string(buf)
+	}))
+
+	req := httptest.NewRequest("POST", "https://example.com/foo", strings.NewReader(body))
+	req.Header.Set("Authorization", test.DefaultUsername)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, received, "handlers should receive the full body")
+}
+
+type tenantKey struct{}
+
+func TestResourceMappers(t *testing.T) {
+	product := func(fields map[string]interface{}) httpmw.StructMapper {
+		return func(*http.Request) *structpb.Struct {
+			res, err := structpb.NewStruct(map[string]interface{}{"product": fields})
+			require.NoError(t, err)
+
+			return res
+		}
+	}
+
+	tests := []struct {
+		name     string
+		conflict middleware.ResourceConflict
+		expected map[string]interface{}
+	}{
+		{
+			"later mappers should overwrite fields by default",
+			middleware.ResourceOverwrite,
+			map[string]interface{}{"id": "123", "tenant": "acme", "product": map[string]interface{}{"name": "Dune"}},
+		},
+		{
+			"earlier fields should be kept",
+			middleware.ResourceKeepFirst,
+			map[string]interface{}{"id": "123", "tenant": "acme", "product": map[string]interface{}{"type": "book"}},
+		},
+		{
+			"objects should be merged",
+			middleware.ResourceDeepMerge,
+			map[string]interface{}{
+				"id":      "123",
+				"tenant":  "acme",
+				"product": map[string]interface{}{"type": "book", "name": "Dune"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resource, err := structpb.NewStruct(tc.expected)
+			require.NoError(t, err)
+
+			expected := test.Request(test.PolicyPath(DefaultPolicyPath), test.Resource(resource))
+
+			mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy(DefaultPolicyPath)).
+				WithResourceMapper(product(map[string]interface{}{"type": "book"})).
+				WithResourceMapper(product(map[string]interface{}{"name": "Dune"})).
+				WithResourceFromContextValue(tenantKey{}, "tenant").
+				WithResourceConflict(tc.conflict)
+			mw.Identity.Subject().ID(test.DefaultUsername)
+
+			req := httptest.NewRequest("GET", "https://example.com/products/123", nil)
+			req.Header.Set("Authorization", test.DefaultUsername)
+			req = mux.SetURLVars(req, map[string]string{"id": "123"})
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "acme"))
+
+			w := httptest.NewRecorder()
+			mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestMappingFailure(t *testing.T) {
+	errMapper := errors.New("mapper error")
+
+	failingResource := func(*http.Request) (*structpb.Struct, error) {
+		return nil, errMapper
+	}
+
+	tests := []struct {
+		name     string
+		failure  middleware.MappingFailure
+		status   int
+		outcome  middleware.Outcome
+		callback func(*httpmw.Middleware)
+	}{
+		{
+			"resource mapper errors should respond with 500 by default",
+			middleware.MappingFailureError,
+			http.StatusInternalServerError,
+			middleware.OutcomeError,
+			func(mw *httpmw.Middleware) { mw.WithResourceMapperE(failingResource) },
+		},
+		{
+			"resource mapper errors should respond with 400",
+			middleware.MappingFailureInvalidArgument,
+			http.StatusBadRequest,
+			middleware.OutcomeError,
+			func(mw *httpmw.Middleware) { mw.WithResourceMapperE(failingResource) },
+		},
+		{
+			"identity mapper errors should be denied",
+			middleware.MappingFailureDeny,
+			http.StatusForbidden,
+			middleware.OutcomeDenied,
+			func(mw *httpmw.Middleware) {
+				mw.Identity.MapperE(func(*http.Request, middleware.Identity) error {
+					return errMapper
+				})
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var event *middleware.Event
+
+			mw := httpmw.New(mock.New(t, nil), test.Policy(DefaultPolicyPath)).
+				WithMappingFailure(tc.failure).
+				WithHook(func(_ context.Context, e *middleware.Event) { event = e })
+			tc.callback(mw)
+
+			req := httptest.NewRequest("GET", "https://example.com/foo", nil)
+			req.Header.Set("Authorization", test.DefaultUsername)
+
+			w := httptest.NewRecorder()
+			mw.Handler(http.HandlerFunc(noopHandler)).ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, tc.outcome, event.Outcome)
+			assert.ErrorIs(t, event.Err, errMapper)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package std
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Route describes the route that matched an incoming request.
+type Route struct {
+	// Template is the path template of the route, with parameters in braces (e.g. "/products/{id}").
+	// It is empty if the template is unknown.
+	Template string
+
+	// Params holds the values of the route's path parameters, keyed by name.
+	Params map[string]string
+}
+
+// RouteMapper functions return the route that matched an incoming request.
+// They return false if the request wasn't routed by the router they support.
+type RouteMapper func(*http.Request) (Route, bool)
+
+// GorillaRoute is a RouteMapper for requests routed by gorilla/mux. It is used by default.
+//
+// The route's template is empty if the request has path variables but no current route, as is the case with requests
+// created using mux.SetURLVars().
+func GorillaRoute(r *http.Request) (Route, bool) {
+	vars := mux.Vars(r)
+	current := mux.CurrentRoute(r)
+
+	if current == nil {
+		return Route{Params: vars}, vars != nil
+	}
+
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		template = ""
+	}
+
+	return Route{Template: template, Params: vars}, true
+}
+
+// WithRouteMappers sets the functions used to find the route that matched an incoming request. The route's
+// template is used to construct policy paths and its parameters are added to the resource context.
+//
+// Mappers are tried in order until one of them returns a route. The default is `GorillaRoute`, followed by
+// `ServeMuxRoute`.
+func (m *Middleware) WithRouteMappers(mappers ...RouteMapper) *Middleware {
+	m.routeMappers = mappers
+	return m
+}
+
+func defaultRouteMappers() []RouteMapper {
+	return []RouteMapper{GorillaRoute, ServeMuxRoute}
+}
+
+// route returns the route that matched r, if any of the middleware's route mappers recognizes it.
+func (m *Middleware) route(r *http.Request) (Route, bool) {
+	for _, mapper := range m.routeMappers {
+		if route, ok := mapper(r); ok {
+			return route, true
+		}
+	}
+
+	return Route{}, false
+}
+
+// policySegments converts a route template to policy path segments. Parameters become segments with two leading
+// underscores. Regular expressions in parameters (e.g. "{id:[0-9]+}") are dropped.
+func policySegments(template string) []string {
+	segments := strings.Split(strings.Trim(template, "/"), "/")
+
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := segment[1 : len(segment)-1]
+			if colon := strings.Index(name, ":"); colon >= 0 {
+				name = name[:colon]
+			}
+
+			segments[i] = "__" + name
+		}
+	}
+
+	return segments
+}
@@ -0,0 +1,52 @@
+package std
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ServeMuxRoute is a RouteMapper for requests routed by an http.ServeMux using patterns with wildcards, such as
+// "GET /products/{id}". It is used by default, after `GorillaRoute`.
+//
+// The request's pattern is only set once the ServeMux has routed it, so the middleware must wrap the handlers
+// registered with the ServeMux rather than the ServeMux itself:
+//
+//   mux.Handle("GET /products/{id}", mw.Handler(productHandler))
+//
+// The method and host in the pattern are not part of the route's template. Wildcards that match the remainder of
+// the path (e.g. "{path...}") are treated like other parameters, and the end-of-path wildcard "{$}" is dropped.
+//
+// ServeMuxRoute reads the request's Pattern, which was added in Go 1.23. It doesn't recognize any requests when the
+// legacy ServeMux is enabled with GODEBUG=httpmuxgo121=1.
+func ServeMuxRoute(r *http.Request) (Route, bool) {
+	if r.Pattern == "" {
+		return Route{}, false
+	}
+
+	path := r.Pattern
+	if i := strings.Index(path, "/"); i >= 0 {
+		// Drop the method and host.
+		path = path[i:]
+	}
+
+	segments := strings.Split(path, "/")
+	template := make([]string, 0, len(segments))
+	params := map[string]string{}
+
+	for _, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			template = append(template, segment)
+			continue
+		}
+
+		name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+		if name == "$" {
+			continue
+		}
+
+		params[name] = r.PathValue(name)
+		template = append(template, "{"+name+"}")
+	}
+
+	return Route{Template: strings.Join(template, "/"), Params: params}, true
+}
@@ -0,0 +1,71 @@
+package std_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http/std"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestServeMuxPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected string
+		params   map[string]interface{}
+	}{
+		{
+			"method and param",
+			"GET /products/{id}",
+			"/products/123",
+			"myapp.GET.products.__id",
+			map[string]interface{}{"id": "123"},
+		},
+		{
+			"host and remainder wildcard",
+			"GET example.com/files/{owner}/{path...}",
+			"/files/alice/docs/a.txt",
+			"myapp.GET.files.__owner.__path",
+			map[string]interface{}{"owner": "alice", "path": "docs/a.txt"},
+		},
+		{
+			"end of path",
+			"/stores/{store}/{$}",
+			"/stores/abc/",
+			"myapp.GET.stores.__store",
+			map[string]interface{}{"store": "abc"},
+		},
+		{"no params", "GET /health", "/health", "myapp.GET.health", map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := structpb.NewStruct(tt.params)
+			require.NoError(t, err)
+
+			expected := test.Request(test.PolicyPath(tt.expected), test.Resource(resource))
+			mw := httpmw.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).WithPolicyFromURL("myapp")
+
+			mux := http.NewServeMux()
+			mux.Handle(tt.pattern, mw.Handler(http.HandlerFunc(noopHandler)))
+
+			req := httptest.NewRequest("GET", "https://example.com"+tt.path, nil)
+			req.Header.Set("Authorization", test.DefaultUsername)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
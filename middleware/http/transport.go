@@ -0,0 +1,335 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// TransportResourceMapper functions build the resource context of outgoing requests.
+type TransportResourceMapper func(*http.Request) (map[string]interface{}, error)
+
+/*
+Transport is an http.RoundTripper that authorizes outgoing requests before sending them. It is used by services that
+call downstream APIs on behalf of their callers, to avoid sending requests that would be denied.
+
+Requests that are denied get a synthetic response with status 403 Forbidden, or an error if the transport is created
+with `WithDenialError()`. Allowed requests are sent using the base RoundTripper.
+
+  client := &http.Client{
+    Transport: httpmw.NewTransport(authClient, middleware.Policy{Decision: "allowed"}, http.DefaultTransport),
+  }
+*/
+type Transport struct {
+	// Identity determines the identity of the user on whose behalf requests are sent. By default, it is the identity
+	// that authorization middleware used for the incoming request whose context the outgoing request is made with.
+	Identity *IdentityBuilder
+
+	base            http.RoundTripper
+	client          authorizer.AuthorizerClient
+	policy          api.PolicyContext
+	policyMapper    func(*http.Request) string
+	resourceMappers []TransportResourceMapper
+	conflict        middleware.ResourceConflict
+	denialError     bool
+	hooks           internal.Hooks
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport creates a Transport that authorizes requests using the specified policy before sending them using
+// base. If base is nil, http.DefaultTransport is used.
+//
+// If the policy has no path, the policy path is built from each request's method, host and URL path
+// (see `WithPolicyFromURL()`). The resource context holds the request's query parameters. Path segments are only
+// added with `WithResourceFromPath()`, because outgoing requests don't have a route that names them.
+func NewTransport(client authorizer.AuthorizerClient, policy middleware.Policy, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t := &Transport{
+		Identity: (&IdentityBuilder{}).FromAuthorizationResult(),
+		base:     base,
+		client:   client,
+		policy:   *internal.DefaultPolicyContext(policy),
+	}
+
+	t.resourceMappers = []TransportResourceMapper{allQueryParams}
+
+	if policy.Path == "" {
+		t.policyMapper = urlPolicyPath("")
+	}
+
+	return t
+}
+
+// WithPolicyFromURL instructs the transport to construct the policy path from the method, host and URL path of
+// outgoing requests.
+//
+// Dots in the host name are replaced with underscores, and path separators ('/') are replaced with dots.
+// An optional prefix can be specified to be included in all paths.
+//
+// Example
+//
+// Using 'WithPolicyFromURL("bff")', the request
+//   GET https://orders.example.com/api/orders/42
+// has the policy path
+//  "bff.GET.orders_example_com.api.orders.42"
+func (t *Transport) WithPolicyFromURL(prefix string) *Transport {
+	t.policyMapper = urlPolicyPath(prefix)
+	return t
+}
+
+// WithPolicyPathMapper sets a custom policy mapper, a function that takes an outgoing request and returns the path
+// within the policy of the package to query.
+func (t *Transport) WithPolicyPathMapper(mapper func(*http.Request) string) *Transport {
+	t.policyMapper = mapper
+	return t
+}
+
+// WithResourceFromQuery limits the query parameters added to the resource context to the specified parameters.
+// Parameters with multiple values are added as lists.
+func (t *Transport) WithResourceFromQuery(params ...string) *Transport {
+	t.resourceMappers[0] = func(r *http.Request) (map[string]interface{}, error) {
+		return internal.QueryFields(r, params), nil
+	}
+
+	return t
+}
+
+/*
+WithResourceFromPath adds the path segments of outgoing requests to the resource context, named by a pattern with
+wildcards like those of http.ServeMux. A "{name...}" wildcard at the end of the pattern matches the rest of the path.
+Requests whose paths don't match the pattern get no fields from it.
+
+Example:
+
+  transport.WithResourceFromPath("/api/orders/{id}")
+
+The request "GET https://orders.example.com/api/orders/42" would have this resource context:
+
+  {
+    "id": "42"
+  }
+*/
+func (t *Transport) WithResourceFromPath(pattern string) *Transport {
+	return t.WithResourceMapper(func(r *http.Request) (map[string]interface{}, error) {
+		return pathParams(pattern, r.URL.Path), nil
+	})
+}
+
+// WithResourceMapper adds a mapper that contributes fields to the resource context of outgoing requests.
+// If the mapper returns an error, the request isn't sent and RoundTrip returns the error.
+func (t *Transport) WithResourceMapper(mapper TransportResourceMapper) *Transport {
+	t.resourceMappers = append(t.resourceMappers, mapper)
+	return t
+}
+
+// WithResourceConflict sets the rule used to combine fields with the same name from different resource mappers.
+// The default is `middleware.ResourceOverwrite`, where fields from later mappers replace those from earlier ones.
+func (t *Transport) WithResourceConflict(conflict middleware.ResourceConflict) *Transport {
+	t.conflict = conflict
+	return t
+}
+
+// WithDenialError instructs the transport to return an error wrapping cerr.ErrAuthorizationFailed for denied requests
+// instead of a synthetic 403 response.
+func (t *Transport) WithDenialError() *Transport {
+	t.denialError = true
+	return t
+}
+
+// WithHook registers a hook that is called after each outgoing request is authorized.
+func (t *Transport) WithHook(hook middleware.Hook) *Transport {
+	t.hooks = append(t.hooks, hook)
+	return t
+}
+
+// RoundTrip authorizes an outgoing request and, if it is allowed, sends it using the base RoundTripper.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	event := &middleware.Event{Operation: r.Method + " " + r.URL.Host + r.URL.Path, Outcome: middleware.OutcomeDenied}
+
+	allowed, err := t.is(r, event)
+	t.hooks.Report(r.Context(), event, start)
+
+	switch {
+	case err != nil:
+		closeBody(r)
+		return nil, err
+	case !allowed && t.denialError:
+		closeBody(r)
+		return nil, errors.Wrapf(cerr.ErrAuthorizationFailed, "%s %s", r.Method, r.URL.Redacted())
+	case !allowed:
+		closeBody(r)
+		return forbidden(r), nil
+	default:
+		return t.base.RoundTrip(r)
+	}
+}
+
+func (t *Transport) is(r *http.Request, event *middleware.Event) (bool, error) {
+	policy := &api.PolicyContext{
+		Id:        t.policy.Id,
+		Path:      t.policy.Path,
+		Decisions: t.policy.Decisions,
+	}
+
+	if t.policyMapper != nil {
+		policy.Path = t.policyMapper(r)
+	}
+
+	event.PolicyPath = policy.Path
+
+	identity, err := t.Identity.Resolve(r)
+	if err != nil {
+		event.Outcome = middleware.OutcomeUnauthenticated
+		if internal.IsMapperError(err) {
+			event.Outcome = middleware.OutcomeError
+		}
+
+		event.Err = err
+
+		return false, err
+	}
+
+	resource, err := t.resourceContext(r)
+	if err != nil {
+		event.Outcome = middleware.OutcomeError
+		event.Err = err
+
+		return false, err
+	}
+
+	result, err := internal.Is(r.Context(), t.client, &authorizer.IsRequest{
+		IdentityContext: identity,
+		PolicyContext:   policy,
+		ResourceContext: resource,
+	})
+	if err == nil && len(result.Decisions) != 1 {
+		err = cerr.ErrInvalidDecision
+	}
+
+	if err != nil {
+		event.Outcome = middleware.OutcomeError
+		event.Err = err
+
+		return false, errors.Wrap(err, "authorization call failed")
+	}
+
+	if result.Decisions[0].Is {
+		event.Outcome = middleware.OutcomeAllowed
+	}
+
+	return result.Decisions[0].Is, nil
+}
+
+func (t *Transport) resourceContext(r *http.Request) (*structpb.Struct, error) {
+	res := map[string]interface{}{}
+
+	for _, mapper := range t.resourceMappers {
+		fields, err := mapper(r)
+		if err != nil {
+			return nil, internal.MapperFailed(err)
+		}
+
+		internal.MergeResource(res, fields, t.conflict)
+	}
+
+	return structpb.NewStruct(res)
+}
+
+func allQueryParams(r *http.Request) (map[string]interface{}, error) {
+	params := make([]string, 0, len(r.URL.Query()))
+	for param := range r.URL.Query() {
+		params = append(params, param)
+	}
+
+	return internal.QueryFields(r, params), nil
+}
+
+// pathParams returns the values of the wildcards in pattern, or an empty map if path doesn't match it.
+func pathParams(pattern, path string) map[string]interface{} {
+	params := map[string]interface{}{}
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		name, opened := strings.CutPrefix(segment, "{")
+		name, closed := strings.CutSuffix(name, "}")
+		wildcard := opened && closed
+
+		if rest, ok := strings.CutSuffix(name, "..."); wildcard && ok && i == len(patternSegments)-1 {
+			if i < len(pathSegments) {
+				params[rest] = strings.Join(pathSegments[i:], "/")
+			}
+
+			return params
+		}
+
+		switch {
+		case i >= len(pathSegments):
+			return map[string]interface{}{}
+		case wildcard:
+			params[name] = pathSegments[i]
+		case segment != pathSegments[i]:
+			return map[string]interface{}{}
+		}
+	}
+
+	if len(pathSegments) != len(patternSegments) {
+		return map[string]interface{}{}
+	}
+
+	return params
+}
+
+func urlPolicyPath(prefix string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		policyPath := []string{r.Method, strings.ReplaceAll(r.URL.Hostname(), ".", "_")}
+
+		if path := strings.Trim(r.URL.Path, "/"); path != "" {
+			policyPath = append(policyPath, strings.Split(path, "/")...)
+		}
+
+		if prefix != "" {
+			policyPath = append([]string{strings.Trim(prefix, ".")}, policyPath...)
+		}
+
+		return strings.Join(policyPath, ".")
+	}
+}
+
+// forbidden returns the synthetic response to a denied request.
+func forbidden(r *http.Request) *http.Response {
+	body := http.StatusText(http.StatusForbidden) + "\n"
+
+	return &http.Response{
+		Status:        "403 " + http.StatusText(http.StatusForbidden),
+		StatusCode:    http.StatusForbidden,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// closeBody closes the body of a request that isn't sent, as required of RoundTrippers.
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close() // nolint:errcheck
+	}
+}
@@ -0,0 +1,129 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	httpmw "github.com/aserto-dev/aserto-go/middleware/http"
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// downstream is a RoundTripper that counts the requests it receives.
+type downstream struct {
+	calls int
+}
+
+func (d *downstream) RoundTrip(r *http.Request) (*http.Response, error) {
+	d.calls++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+}
+
+// callerContext returns the context of an incoming request authorized for the default user.
+func callerContext() context.Context {
+	return middleware.ContextWithAuthorizationResult(context.Background(), &middleware.AuthorizationResult{
+		Identity: &api.IdentityContext{Type: test.DefaultIdentityType, Identity: test.DefaultUsername},
+	})
+}
+
+func get(t *testing.T, transport http.RoundTripper, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(callerContext(), "GET", url, nil)
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	return resp, err
+}
+
+func TestTransportAllowed(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"expand": "items"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("bff.GET.orders_example_com.api.orders.42"), test.Resource(resource))
+	base := &downstream{}
+	transport := httpmw.NewTransport(mock.New(t, expected, test.Decision(true)), test.Policy(""), base).
+		WithPolicyFromURL("bff")
+
+	resp, err := get(t, transport, "https://orders.example.com/api/orders/42?expand=items")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, base.calls)
+}
+
+func TestTransportDenied(t *testing.T) {
+	expected := test.Request(test.PolicyPath("GET.orders_example_com.api.orders"))
+	base := &downstream{}
+	transport := httpmw.NewTransport(mock.New(t, expected, test.Decision(false)), test.Policy(""), base)
+
+	resp, err := get(t, transport, "https://orders.example.com/api/orders")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, 0, base.calls)
+}
+
+func TestTransportDenialError(t *testing.T) {
+	expected := test.Request(test.PolicyPath("orders.read"))
+	base := &downstream{}
+	transport := httpmw.NewTransport(mock.New(t, expected, test.Decision(false)), test.Policy("orders.read"), base).
+		WithResourceFromQuery("id").
+		WithDenialError()
+
+	_, err := get(t, transport, "https://orders.example.com/api/orders?limit=10")
+
+	assert.ErrorIs(t, err, cerr.ErrAuthorizationFailed)
+	assert.Equal(t, 0, base.calls)
+}
+
+func TestTransportResourceFromPath(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"id": "42", "rest": "items/7"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("orders.read"), test.Resource(resource))
+	base := &downstream{}
+	transport := httpmw.NewTransport(mock.New(t, expected, test.Decision(true)), test.Policy("orders.read"), base).
+		WithResourceFromQuery().
+		WithResourceFromPath("/api/customers/{customer}").
+		WithResourceFromPath("/api/orders/{id}/{rest...}")
+
+	_, err = get(t, transport, "https://orders.example.com/api/orders/42/items/7?expand=items")
+	require.NoError(t, err)
+	assert.Equal(t, 1, base.calls)
+}
+
+func TestTransportResourceConflict(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"order": map[string]interface{}{"id": "42", "region": "eu"},
+	})
+	require.NoError(t, err)
+
+	mapper := func(key, value string) httpmw.TransportResourceMapper {
+		return func(*http.Request) (map[string]interface{}, error) {
+			return map[string]interface{}{"order": map[string]interface{}{key: value}}, nil
+		}
+	}
+
+	expected := test.Request(test.PolicyPath("orders.read"), test.Resource(resource))
+	base := &downstream{}
+	transport := httpmw.NewTransport(mock.New(t, expected, test.Decision(true)), test.Policy("orders.read"), base).
+		WithResourceMapper(mapper("id", "42")).
+		WithResourceMapper(mapper("region", "eu")).
+		WithResourceConflict(middleware.ResourceDeepMerge)
+
+	_, err = get(t, transport, "https://orders.example.com/api/orders")
+	require.NoError(t, err)
+	assert.Equal(t, 1, base.calls)
+}
@@ -1,5 +1,7 @@
 package middleware
 
+import "strings"
+
 /*
 Identity provides methods to set caller identity parameters.
 
@@ -24,3 +26,20 @@ type Identity interface {
 	// ID sets the identity value - a string that represents a user ID or a JWT token.
 	ID(identity string) Identity
 }
+
+// IdentityTransform functions post-process caller subjects before they are sent to the authorizer.
+// Transforms that return an empty string make the request anonymous.
+type IdentityTransform func(string) string
+
+// Lowercase is an IdentityTransform that converts identities to lower case. It is useful for case-insensitive
+// identifiers like email addresses.
+func Lowercase(identity string) string {
+	return strings.ToLower(identity)
+}
+
+// TrimPrefix returns an IdentityTransform that removes a prefix from identities (e.g. "user:" or "auth0|").
+func TrimPrefix(prefix string) IdentityTransform {
+	return func(identity string) string {
+		return strings.TrimPrefix(identity, prefix)
+	}
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ResourceMapper functions return fields to add to the resource context of a request of type T.
+type ResourceMapper[T any] func(T) (map[string]interface{}, error)
+
+// HTTPAuthorizer holds the settings shared by the HTTP middleware of all frameworks and authorizes requests with them.
+// T is the type through which a framework exposes requests, such as *http.Request or *gin.Context. Middleware only
+// read request data from T and write the resulting HTTPDecision the way their framework expects.
+type HTTPAuthorizer[T any] struct {
+	Client           authz.AuthorizerClient
+	Policy           *api.PolicyContext
+	PolicyMapper     func(T) string
+	Identity         func(T) (*api.IdentityContext, error)
+	ResourceMappers  []ResourceMapper[T]
+	ResourceConflict middleware.ResourceConflict
+	ExemptRoutes     RouteRules
+	RoutePolicies    RouteRules
+	DenyByDefault    bool
+	Hooks            Hooks
+	DenialDetails    *middleware.DenialDetailsOptions
+	MaxBodySize      int64
+	MappingFailure   middleware.MappingFailure
+}
+
+// HTTPDecision is the outcome of authorizing an HTTP request.
+type HTTPDecision struct {
+	// Allowed is true if the request can be passed on to the next handler.
+	Allowed bool
+
+	// Result is the result of the authorization call. It is nil for exempt requests and for requests rejected without
+	// calling the authorizer.
+	Result *middleware.AuthorizationResult
+
+	// Status is the HTTP status of the response to rejected requests.
+	Status int
+
+	// Challenge is the value of the WWW-Authenticate header of the response to rejected requests, if any.
+	Challenge string
+
+	// Problem is the body of the response to denied requests if denial details are enabled. Its content type is
+	// ProblemContentType.
+	Problem []byte
+
+	// Err is the error that caused the request to be rejected, if any.
+	Err error
+}
+
+// Authorize authorizes a request with the specified method and URL path and reports the outcome to hooks.
+func (a *HTTPAuthorizer[T]) Authorize(ctx context.Context, in T, method, path string) *HTTPDecision {
+	start := time.Now()
+	event := &middleware.Event{Operation: method + " " + path, Outcome: middleware.OutcomeExempt}
+
+	if a.ExemptRoutes.Match(method, path) {
+		a.Hooks.Report(ctx, event, start)
+		return &HTTPDecision{Allowed: true}
+	}
+
+	allowed, result, err := a.is(ctx, in, method, path, event)
+	a.Hooks.Report(ctx, event, start)
+
+	switch {
+	case IsMapperError(err) && a.MappingFailure == middleware.MappingFailureDeny:
+		return a.deny(ctx, nil)
+	case IsMapperError(err):
+		return &HTTPDecision{Status: MappingHTTPStatus(a.MappingFailure), Err: err}
+	case errors.Is(err, middleware.ErrUnauthenticated):
+		return &HTTPDecision{Status: http.StatusUnauthorized, Challenge: BearerChallenge, Err: err}
+	case err != nil:
+		return &HTTPDecision{Status: http.StatusInternalServerError, Err: err}
+	case !allowed:
+		return a.deny(ctx, result)
+	}
+
+	return &HTTPDecision{Allowed: true, Result: result}
+}
+
+// is authorizes a request. It returns the result of the authorization call, which is nil if the request was denied
+// without calling the authorizer.
+func (a *HTTPAuthorizer[T]) is(
+	ctx context.Context,
+	in T,
+	method, path string,
+	event *middleware.Event,
+) (bool, *middleware.AuthorizationResult, error) {
+	policy := &api.PolicyContext{
+		Id:        a.Policy.GetId(),
+		Path:      a.Policy.GetPath(),
+		Decisions: a.Policy.GetDecisions(),
+	}
+
+	if a.PolicyMapper != nil {
+		policy.Path = a.PolicyMapper(in)
+	}
+
+	route, routed := a.RoutePolicies.Find(method, path)
+	if route.PolicyPath != "" {
+		policy.Path = route.PolicyPath
+	}
+
+	event.PolicyPath = policy.Path
+	event.Outcome = middleware.OutcomeDenied
+
+	if a.DenyByDefault && (policy.Path == "" || !routed) {
+		return false, nil, nil
+	}
+
+	identity, err := a.Identity(in)
+	if err != nil {
+		event.Outcome = middleware.OutcomeUnauthenticated
+		if IsMapperError(err) {
+			event.Outcome = MappingOutcome(a.MappingFailure)
+		}
+
+		event.Err = err
+
+		return false, nil, err
+	}
+
+	resource, err := a.resourceContext(in)
+	if err != nil {
+		event.Outcome = MappingOutcome(a.MappingFailure)
+		event.Err = err
+
+		return false, nil, err
+	}
+
+	result, err := Is(ctx, a.Client, &authz.IsRequest{
+		IdentityContext: identity,
+		PolicyContext:   policy,
+		ResourceContext: resource,
+	})
+	if err == nil && len(result.Decisions) != 1 {
+		err = cerr.ErrInvalidDecision
+	}
+
+	if err != nil {
+		event.Outcome = middleware.OutcomeError
+		event.Err = err
+
+		return false, nil, err
+	}
+
+	if result.Decisions[0].Is {
+		event.Outcome = middleware.OutcomeAllowed
+	}
+
+	return result.Decisions[0].Is, result, nil
+}
+
+// resourceContext returns the resource context of a request, or nil if there are no resource mappers.
+// Errors returned by mappers are wrapped in a MapperError.
+func (a *HTTPAuthorizer[T]) resourceContext(in T) (*structpb.Struct, error) {
+	if len(a.ResourceMappers) == 0 {
+		return nil, nil
+	}
+
+	resource := map[string]interface{}{}
+
+	for _, mapper := range a.ResourceMappers {
+		fields, err := mapper(in)
+		if err != nil {
+			return nil, MapperFailed(err)
+		}
+
+		MergeResource(resource, fields, a.ResourceConflict)
+	}
+
+	res, err := structpb.NewStruct(resource)
+	if err != nil {
+		return nil, MapperFailed(err)
+	}
+
+	return res, nil
+}
+
+// deny returns the decision for a denied request. Denial details are only included if the authorizer was called.
+func (a *HTTPAuthorizer[T]) deny(ctx context.Context, result *middleware.AuthorizationResult) *HTTPDecision {
+	decision := &HTTPDecision{Status: http.StatusForbidden}
+
+	if a.DenialDetails != nil && result != nil {
+		details := NewDenialDetails(ctx, a.Client, result, FirstDecision(result), a.DenialDetails)
+		decision.Problem = ProblemJSON(details)
+	}
+
+	return decision
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+)
+
+// IdentityMapper sets the caller's identity from an incoming value of type T, such as an HTTP request or a message.
+type IdentityMapper[T any] func(context.Context, T, middleware.Identity) error
+
+// IdentityBuilder holds the settings shared by the identity builders of all transports and resolves caller identities
+// from them. Transport-specific builders only provide the identity sources that read from T.
+//
+// The zero value resolves all callers as anonymous.
+type IdentityBuilder[T any] struct {
+	identityType    api.IdentityType
+	defaultIdentity string
+	mapper          IdentityMapper[T]
+	sources         []*IdentityBuilder[T]
+	verifier        *middleware.JWTVerifier
+	transforms      []middleware.IdentityTransform
+}
+
+// SetType sets the identity type. Values of unknown type are inferred from the identity when it is resolved.
+func (b *IdentityBuilder[T]) SetType(identityType api.IdentityType) {
+	b.identityType = identityType
+}
+
+// SetID sets the identity used if the mapper doesn't set one.
+func (b *IdentityBuilder[T]) SetID(identity string) {
+	b.defaultIdentity = identity
+}
+
+// None makes callers anonymous unless the mapper sets an identity.
+func (b *IdentityBuilder[T]) None() {
+	b.identityType = api.IdentityType_IDENTITY_TYPE_NONE
+	b.defaultIdentity = ""
+}
+
+// SetMapper sets the function that reads the caller's identity. It replaces any previous mapper or sources.
+func (b *IdentityBuilder[T]) SetMapper(mapper IdentityMapper[T]) {
+	b.mapper = mapper
+	b.sources = nil
+}
+
+// SetSources makes the builder read the caller's identity from the first of the sources that yields one. It replaces
+// any previous mapper or sources.
+//
+// Each source is verified and transformed with its own settings. Sources that don't have an identity type use the
+// builder's type. The builder's verifier only applies to tokens from sources that don't have a verifier, and its
+// transforms to subjects.
+func (b *IdentityBuilder[T]) SetSources(sources ...*IdentityBuilder[T]) {
+	b.sources = sources
+	b.mapper = nil
+}
+
+// SetVerifier sets the verifier used to validate JWT identities.
+func (b *IdentityBuilder[T]) SetVerifier(verifier *middleware.JWTVerifier) {
+	b.verifier = verifier
+}
+
+// AddTransforms adds functions applied in order to resolved subject identities.
+func (b *IdentityBuilder[T]) AddTransforms(transforms ...middleware.IdentityTransform) {
+	b.transforms = append(b.transforms, transforms...)
+}
+
+// Build returns the caller's identity, or an anonymous identity if it can't be resolved.
+func (b *IdentityBuilder[T]) Build(ctx context.Context, in T) *api.IdentityContext {
+	identity, err := b.Resolve(ctx, in)
+	if err != nil {
+		return NewIdentity(api.IdentityType_IDENTITY_TYPE_NONE, "").Context()
+	}
+
+	return identity
+}
+
+// Resolve returns the caller's identity after it is verified and transformed. Mapper errors are wrapped in a
+// MapperError. If JWT verification is enabled, an error wrapping middleware.ErrUnauthenticated is returned for invalid
+// tokens.
+func (b *IdentityBuilder[T]) Resolve(ctx context.Context, in T) (*api.IdentityContext, error) {
+	return b.resolve(ctx, in, api.IdentityType_IDENTITY_TYPE_UNKNOWN, nil)
+}
+
+// resolve is like Resolve. Identities without a type are given identityType. If the builder has no verifier, tokens
+// are verified with the inherited verifier.
+func (b *IdentityBuilder[T]) resolve(
+	ctx context.Context,
+	in T,
+	identityType api.IdentityType,
+	inherited *middleware.JWTVerifier,
+) (*api.IdentityContext, error) {
+	if b.identityType != api.IdentityType_IDENTITY_TYPE_UNKNOWN {
+		identityType = b.identityType
+	}
+
+	verifier := b.verifier
+	if verifier == nil {
+		verifier = inherited
+	}
+
+	if len(b.sources) > 0 {
+		return b.resolveFirstOf(ctx, in, identityType, verifier)
+	}
+
+	identity := NewIdentity(identityType, b.defaultIdentity)
+
+	if b.mapper != nil {
+		if err := b.mapper(ctx, in, identity); err != nil {
+			return nil, MapperFailed(err)
+		}
+	}
+
+	if b.verifier == nil && !identity.isToken() {
+		verifier = nil
+	}
+
+	return identity.Resolve(ctx, verifier, b.transforms)
+}
+
+// resolveFirstOf resolves the identity from the first source that yields one.
+func (b *IdentityBuilder[T]) resolveFirstOf(
+	ctx context.Context,
+	in T,
+	identityType api.IdentityType,
+	verifier *middleware.JWTVerifier,
+) (*api.IdentityContext, error) {
+	for _, source := range b.sources {
+		resolved, err := source.resolve(ctx, in, identityType, verifier)
+		if err != nil {
+			return nil, err
+		}
+
+		if resolved.Type == api.IdentityType_IDENTITY_TYPE_NONE {
+			continue
+		}
+
+		return NewIdentity(resolved.Type, resolved.Identity).Resolve(ctx, nil, b.transforms)
+	}
+
+	return NewIdentity(api.IdentityType_IDENTITY_TYPE_NONE, "").Context(), nil
+}
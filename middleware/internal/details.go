@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+)
+
+const (
+	// ProblemContentType is the media type of HTTP responses with denial details (RFC 7807).
+	ProblemContentType = "application/problem+json"
+
+	outputsBinding = "outputs"
+	reasonRule     = "reason"
+)
+
+// NewDenialDetails returns the details of a denied authorization request.
+//
+// The policy is queried for the values of its rules to find its reason. The values of all rules are only included if
+// options.IncludeOutputs is set. Errors from the query are ignored and result in details without outputs or reason.
+func NewDenialDetails(
+	ctx context.Context,
+	client authz.AuthorizerClient,
+	result *middleware.AuthorizationResult,
+	decision string,
+	options *middleware.DenialDetailsOptions,
+) *middleware.DenialDetails {
+	details := &middleware.DenialDetails{
+		PolicyPath: result.Policy.GetPath(),
+		Decision:   decision,
+	}
+
+	outputs := queryOutputs(ctx, client, result)
+	if reason, ok := outputs[reasonRule].(string); ok {
+		details.Reason = reason
+	}
+
+	if options.IncludeOutputs {
+		details.Outputs = outputs
+	}
+
+	if options.Redact != nil {
+		options.Redact(details)
+	}
+
+	return details
+}
+
+// FirstDecision returns the name of the first decision in an authorization result, or an empty string if it has no
+// decisions.
+func FirstDecision(result *middleware.AuthorizationResult) string {
+	if decisions := result.Policy.GetDecisions(); len(decisions) > 0 {
+		return decisions[0]
+	}
+
+	return ""
+}
+
+func queryOutputs(
+	ctx context.Context,
+	client authz.AuthorizerClient,
+	result *middleware.AuthorizationResult,
+) map[string]interface{} {
+	resp, err := client.Query(ctx, &authz.QueryRequest{
+		Query:           outputsBinding + " = data." + result.Policy.GetPath(),
+		IdentityContext: result.Identity,
+		PolicyContext:   result.Policy,
+		ResourceContext: result.Resource,
+	})
+	if err != nil || len(resp.GetResults()) == 0 {
+		return nil
+	}
+
+	values := resp.GetResults()[0].AsMap()
+	if bindings, ok := values["bindings"].(map[string]interface{}); ok {
+		values = bindings
+	}
+
+	outputs, _ := values[outputsBinding].(map[string]interface{})
+
+	return outputs
+}
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	*middleware.DenialDetails
+}
+
+// ProblemJSON returns the body of an HTTP 403 response with the specified denial details.
+func ProblemJSON(details *middleware.DenialDetails) []byte {
+	body, err := json.Marshal(&problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(http.StatusForbidden),
+		Status:        http.StatusForbidden,
+		Detail:        details.Reason,
+		DenialDetails: details,
+	})
+	if err != nil {
+		// Outputs can't be marshaled. Send the remaining details.
+		details.Outputs = nil
+		return ProblemJSON(details)
+	}
+
+	return body
+}
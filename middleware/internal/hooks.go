@@ -0,0 +1,20 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+)
+
+// Hooks is a list of middleware hooks.
+type Hooks []middleware.Hook
+
+// Report calls all hooks with the specified event after setting its duration.
+func (h Hooks) Report(ctx context.Context, event *middleware.Event, start time.Time) {
+	event.Duration = time.Since(start)
+
+	for _, hook := range h {
+		hook(ctx, event)
+	}
+}
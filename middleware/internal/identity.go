@@ -1,10 +1,58 @@
 package internal
 
 import (
+	"context"
+	"strings"
+
 	"github.com/aserto-dev/aserto-go/middleware"
 	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/lestrrat-go/jwx/jwt"
 )
 
+const (
+	// BearerChallenge is the value of the WWW-Authenticate header in HTTP responses to requests with invalid tokens
+	// (RFC 6750).
+	BearerChallenge = `Bearer error="invalid_token"`
+
+	// AuthorizationHeader is the name of the HTTP header and gRPC metadata key that carries caller credentials.
+	// Names are compared case-insensitively.
+	AuthorizationHeader = "authorization"
+
+	bearerScheme = "bearer"
+)
+
+// IdentityValue returns the identity carried in a header or metadata field.
+// The "Bearer" authentication scheme is removed from values of the authorization header.
+func IdentityValue(name, value string) string {
+	value = strings.TrimSpace(value)
+
+	if !strings.EqualFold(name, AuthorizationHeader) {
+		return value
+	}
+
+	if len(value) > len(bearerScheme) && strings.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+		return strings.TrimSpace(value[len(bearerScheme):])
+	}
+
+	return value
+}
+
+// HostnameSegment returns a segment of a dot-separated hostname. Indexing is zero-based and starts from the left.
+// Negative indices start from the right. It returns an empty string if the index is out of range.
+func HostnameSegment(hostname string, level int) string {
+	parts := strings.Split(hostname, ".")
+
+	if level < 0 {
+		level += len(parts)
+	}
+
+	if level >= 0 && level < len(parts) {
+		return parts[level]
+	}
+
+	return ""
+}
+
 type Identity struct {
 	context api.IdentityContext
 }
@@ -51,10 +99,136 @@ func (id *Identity) ID(identity string) middleware.Identity {
 	return id
 }
 
+// Context returns the identity context to send to the authorizer.
+//
+// If no identity type was set, the type is inferred from the identity: JWTs are sent as such and other values are
+// sent as subjects. If the identity type is subject and the identity is a JWT, the token's subject is sent instead of
+// the token. The token isn't verified; use Verify to check its signature first. Tokens without a subject are
+// anonymous.
 func (id *Identity) Context() *api.IdentityContext {
 	if id.context.Identity == "" {
 		id.None()
+		return &id.context
+	}
+
+	switch id.context.Type {
+	case api.IdentityType_IDENTITY_TYPE_UNKNOWN:
+		if isJWT(id.context.Identity) {
+			id.JWT()
+		} else {
+			id.Subject()
+		}
+	case api.IdentityType_IDENTITY_TYPE_SUB:
+		if token, ok := parseJWT(id.context.Identity); ok {
+			if token.Subject() == "" {
+				id.None()
+			} else {
+				id.ID(token.Subject())
+			}
+		}
 	}
 
 	return &id.context
 }
+
+// Verify verifies the identity's token and returns the identity context to send to the authorizer.
+//
+// Anonymous identities aren't verified. If the identity type is subject, the identity is replaced with the token's
+// subject. Otherwise, the verified token is sent as a JWT identity.
+func (id *Identity) Verify(ctx context.Context, verifier *middleware.JWTVerifier) (*api.IdentityContext, error) {
+	if id.context.Identity == "" || id.context.Type == api.IdentityType_IDENTITY_TYPE_NONE {
+		id.None()
+		return id.Context(), nil
+	}
+
+	token, err := verifier.Verify(ctx, id.context.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if id.IsSubject() {
+		id.ID(token.Subject())
+	} else {
+		id.JWT()
+	}
+
+	return id.Context(), nil
+}
+
+// parseJWT parses a compact-serialized JWT without verifying its signature.
+func parseJWT(value string) (jwt.Token, bool) {
+	if strings.Count(value, ".") != 2 {
+		return nil, false
+	}
+
+	token, err := jwt.ParseString(value)
+	if err != nil {
+		return nil, false
+	}
+
+	return token, true
+}
+
+// isJWT reports whether value parses as a compact-serialized JWT. The token's signature isn't verified.
+func isJWT(value string) bool {
+	_, ok := parseJWT(value)
+	return ok
+}
+
+// isToken reports whether the identity is a JWT, either because its type is JWT or because its value parses as one.
+func (id *Identity) isToken() bool {
+	return id.context.Type == api.IdentityType_IDENTITY_TYPE_JWT || isJWT(id.context.Identity)
+}
+
+// IsSet reports whether the identity has a value and isn't anonymous.
+func (id *Identity) IsSet() bool {
+	return id.context.Identity != "" && id.context.Type != api.IdentityType_IDENTITY_TYPE_NONE
+}
+
+// CopyTo sets the type and value of another identity to those of id. If id has no type, the other identity's type
+// is left unchanged.
+func (id *Identity) CopyTo(other middleware.Identity) {
+	switch id.context.Type {
+	case api.IdentityType_IDENTITY_TYPE_JWT:
+		other.JWT()
+	case api.IdentityType_IDENTITY_TYPE_SUB:
+		other.Subject()
+	case api.IdentityType_IDENTITY_TYPE_NONE:
+		other.None()
+		return
+	}
+
+	other.ID(id.context.Identity)
+}
+
+// Resolve returns the identity context to send to the authorizer. If a verifier is specified, the identity's token
+// is verified. Transforms are applied in order to the resulting identity if it is a subject.
+func (id *Identity) Resolve(
+	ctx context.Context,
+	verifier *middleware.JWTVerifier,
+	transforms []middleware.IdentityTransform,
+) (*api.IdentityContext, error) {
+	var identity *api.IdentityContext
+
+	if verifier == nil {
+		identity = id.Context()
+	} else {
+		var err error
+		if identity, err = id.Verify(ctx, verifier); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(transforms) == 0 || identity.Type != api.IdentityType_IDENTITY_TYPE_SUB {
+		return identity, nil
+	}
+
+	value := identity.Identity
+	for _, transform := range transforms {
+		value = transform(value)
+	}
+
+	id.ID(value)
+
+	return id.Context(), nil
+}
@@ -0,0 +1,88 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func token(t *testing.T, subject string) string {
+	tok := jwt.New()
+	require.NoError(t, tok.Set(jwt.SubjectKey, subject))
+
+	signed, err := jwt.Sign(tok, jwa.HS256, []byte("secret"))
+	require.NoError(t, err)
+
+	return string(signed)
+}
+
+func TestIdentityValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"Authorization", "Bearer token", "token"},
+		{"authorization", "bearer  token ", "token"},
+		{"authorization", "token", "token"},
+		{"authorization", "Bearer", "Bearer"},
+		{"X-Identity", "Bearer token", "Bearer token"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, internal.IdentityValue(test.name, test.value), test.value)
+	}
+}
+
+func TestIdentityContext(t *testing.T) {
+	jwtValue := token(t, "george")
+
+	tests := []struct {
+		name         string
+		identityType api.IdentityType
+		value        string
+		expected     *api.IdentityContext
+	}{
+		{
+			"untyped JWTs should be inferred",
+			api.IdentityType_IDENTITY_TYPE_UNKNOWN,
+			jwtValue,
+			&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_JWT, Identity: jwtValue},
+		},
+		{
+			"untyped values should be subjects",
+			api.IdentityType_IDENTITY_TYPE_UNKNOWN,
+			"george",
+			&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "george"},
+		},
+		{
+			"subjects should be extracted from JWTs",
+			api.IdentityType_IDENTITY_TYPE_SUB,
+			jwtValue,
+			&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_SUB, Identity: "george"},
+		},
+		{
+			"JWTs without subjects should be anonymous",
+			api.IdentityType_IDENTITY_TYPE_SUB,
+			token(t, ""),
+			&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_NONE},
+		},
+		{
+			"empty values should be anonymous",
+			api.IdentityType_IDENTITY_TYPE_JWT,
+			"",
+			&api.IdentityContext{Type: api.IdentityType_IDENTITY_TYPE_NONE},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, internal.NewIdentity(test.identityType, test.value).Context())
+		})
+	}
+}
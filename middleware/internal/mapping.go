@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/go-utils/cerr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MapperError wraps errors returned by resource and identity mappers.
+type MapperError struct {
+	Err error
+}
+
+func (e *MapperError) Error() string {
+	return "mapper failed: " + e.Err.Error()
+}
+
+func (e *MapperError) Unwrap() error {
+	return e.Err
+}
+
+// MapperFailed returns a MapperError that wraps err, or nil if err is nil.
+func MapperFailed(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &MapperError{Err: err}
+}
+
+// IsMapperError returns true if err was returned by a resource or identity mapper.
+func IsMapperError(err error) bool {
+	var mapperErr *MapperError
+	return errors.As(err, &mapperErr)
+}
+
+// MappingOutcome returns the outcome reported to hooks when a mapper fails.
+func MappingOutcome(failure middleware.MappingFailure) middleware.Outcome {
+	if failure == middleware.MappingFailureDeny {
+		return middleware.OutcomeDenied
+	}
+
+	return middleware.OutcomeError
+}
+
+// MappingHTTPStatus returns the HTTP status code of responses to requests for which a mapper failed.
+func MappingHTTPStatus(failure middleware.MappingFailure) int {
+	switch failure {
+	case middleware.MappingFailureDeny:
+		return http.StatusForbidden
+	case middleware.MappingFailureInvalidArgument:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// MappingGRPCError returns the error that gRPC middleware returns from calls for which a mapper failed.
+func MappingGRPCError(failure middleware.MappingFailure, err error) error {
+	switch failure {
+	case middleware.MappingFailureDeny:
+		return cerr.ErrAuthorizationFailed
+	case middleware.MappingFailureInvalidArgument:
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
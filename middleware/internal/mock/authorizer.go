@@ -10,21 +10,32 @@ import (
 )
 
 type Authorizer struct {
-	t        *testing.T
-	expected *authorizer.IsRequest
-	response authorizer.IsResponse
+	t     *testing.T
+	calls []*call
+
+	// QueryResponse is returned from calls to Query.
+	QueryResponse *authorizer.QueryResponse
 }
 
-func New(t *testing.T, expectedRequest *authorizer.IsRequest, decision *authorizer.Decision) *Authorizer {
+func New(t *testing.T, expectedRequest *authorizer.IsRequest, decisions ...*authorizer.Decision) *Authorizer {
 	return &Authorizer{
-		t:        t,
-		expected: expectedRequest,
-		response: authorizer.IsResponse{
-			Decisions: []*authorizer.Decision{decision},
-		},
+		t:     t,
+		calls: []*call{{expectedRequest, &authorizer.IsResponse{Decisions: decisions}}},
 	}
 }
 
+// Then adds a call to Is expected after the previous ones. Once all calls are made, further calls are expected to
+// match the last one.
+func (c *Authorizer) Then(expectedRequest *authorizer.IsRequest, decisions ...*authorizer.Decision) *Authorizer {
+	c.calls = append(c.calls, &call{expectedRequest, &authorizer.IsResponse{Decisions: decisions}})
+	return c
+}
+
+type call struct {
+	expected *authorizer.IsRequest
+	response *authorizer.IsResponse
+}
+
 var _ authorizer.AuthorizerClient = (*Authorizer)(nil)
 
 func (c *Authorizer) DecisionTree(
@@ -40,8 +51,14 @@ func (c *Authorizer) Is(
 	in *authorizer.IsRequest,
 	opts ...grpc.CallOption,
 ) (*authorizer.IsResponse, error) {
-	assert.Equal(c.t, c.expected, in)
-	return &c.response, nil
+	next := c.calls[0]
+	if len(c.calls) > 1 {
+		c.calls = c.calls[1:]
+	}
+
+	assert.Equal(c.t, next.expected, in)
+
+	return next.response, nil
 }
 
 func (c *Authorizer) Query(
@@ -49,5 +66,5 @@ func (c *Authorizer) Query(
 	in *authorizer.QueryRequest,
 	opts ...grpc.CallOption,
 ) (*authorizer.QueryResponse, error) {
-	return nil, nil
+	return c.QueryResponse, nil
 }
@@ -3,8 +3,10 @@ package mock
 import (
 	"context"
 	"errors"
+	"io"
 
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
 var errNotImplemented = errors.New("not implemented")
@@ -12,6 +14,9 @@ var errNotImplemented = errors.New("not implemented")
 // Mock grpc.ServerStream.
 type ServerStream struct {
 	Ctx context.Context
+
+	// Messages are returned, in order, from calls to RecvMsg.
+	Messages []proto.Message
 }
 
 func (s *ServerStream) SetHeader(metadata.MD) error {
@@ -34,5 +39,17 @@ func (s *ServerStream) SendMsg(m interface{}) error {
 }
 
 func (s *ServerStream) RecvMsg(m interface{}) error {
-	return errNotImplemented
+	if len(s.Messages) == 0 {
+		return io.EOF
+	}
+
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return errNotImplemented
+	}
+
+	proto.Merge(msg, s.Messages[0])
+	s.Messages = s.Messages[1:]
+
+	return nil
 }
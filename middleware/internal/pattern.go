@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"strings"
+)
+
+// MatchPattern reports whether value matches a slash-separated glob pattern.
+//
+// A '*' matches any sequence of characters within a single segment, and a '**' segment matches any number of
+// segments, including none. Patterns without wildcards must match exactly.
+func MatchPattern(pattern, value string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(value, "/"))
+}
+
+func matchSegments(pattern, value []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(value); i++ {
+				if matchSegments(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(value) == 0 || !matchSegment(pattern[0], value[0]) {
+			return false
+		}
+
+		pattern, value = pattern[1:], value[1:]
+	}
+
+	return len(value) == 0
+}
+
+func matchSegment(pattern, value string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, pattern[:star]) {
+		return false
+	}
+
+	rest := pattern[star+1:]
+	for i := star; i <= len(value); i++ {
+		if matchSegment(rest, value[i:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RouteRule matches HTTP requests by method and URL path pattern.
+type RouteRule struct {
+	// Method is the HTTP method to match. An empty string or "*" match all methods.
+	Method string
+
+	// Pattern is a path pattern as accepted by MatchPattern.
+	Pattern string
+
+	// PolicyPath is the policy path evaluated for matching requests. An empty string keeps the path determined by
+	// the middleware's policy mapper.
+	PolicyPath string
+}
+
+func (r RouteRule) Match(method, path string) bool {
+	if r.Method != "" && r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+
+	return MatchPattern(r.Pattern, path)
+}
+
+type RouteRules []RouteRule
+
+func (rules RouteRules) Match(method, path string) bool {
+	_, ok := rules.Find(method, path)
+	return ok
+}
+
+// Find returns the first rule that matches the specified method and path.
+func (rules RouteRules) Find(method, path string) (RouteRule, bool) {
+	for _, rule := range rules {
+		if rule.Match(method, path) {
+			return rule, true
+		}
+	}
+
+	return RouteRule{}, false
+}
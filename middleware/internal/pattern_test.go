@@ -0,0 +1,54 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{"/healthz", "/healthz", true},
+		{"/healthz", "/healthz/live", false},
+		{"/api/*/status", "/api/products/status", true},
+		{"/api/*/status", "/api/products/123/status", false},
+		{"/api/**/status", "/api/products/123/status", true},
+		{"/api/**", "/api", true},
+		{"/**", "/", true},
+		{"/grpc.health.v1.Health/*", "/grpc.health.v1.Health/Check", true},
+		{"/grpc.reflection.*/*", "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", true},
+		{"/example.*Service/Get*", "/example.ProductService/GetProduct", true},
+		{"/example.*Service/Get*", "/example.ProductService/ListProducts", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(
+			t,
+			test.match,
+			internal.MatchPattern(test.pattern, test.value),
+			"pattern: %s, value: %s", test.pattern, test.value,
+		)
+	}
+}
+
+func TestRouteRules(t *testing.T) {
+	rules := internal.RouteRules{
+		{Method: "GET", Pattern: "/products/*", PolicyPath: "products.read"},
+		{Method: "*", Pattern: "/products/**", PolicyPath: "products.write"},
+	}
+
+	rule, ok := rules.Find("get", "/products/123")
+	assert.True(t, ok)
+	assert.Equal(t, "products.read", rule.PolicyPath)
+
+	rule, ok = rules.Find("DELETE", "/products/123")
+	assert.True(t, ok)
+	assert.Equal(t, "products.write", rule.PolicyPath)
+
+	assert.False(t, rules.Match("GET", "/orders/123"))
+}
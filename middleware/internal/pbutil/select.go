@@ -0,0 +1,430 @@
+/*
+Package pbutil selects fields from protobuf messages.
+
+Fields are identified by dot-separated paths of field names (e.g. "product.type"). Each name can be either the
+field's JSON name or its name in the .proto file.
+
+Elements of repeated fields and values of map fields are selected using the "*" wildcard (e.g. "items.*.id").
+A single map entry can be selected using its key (e.g. "labels.env"). Naming a oneof selects whichever of its fields
+is set.
+*/
+package pbutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var ErrBadMask = errors.New("invalid mask")
+
+const (
+	pathSeparator = "."
+	wildcard      = "*"
+)
+
+// Select returns a struct with the values of the specified fields of msg. Selected fields keep their nesting and
+// are keyed by the names used in the paths. Messages selected as a whole are converted using their JSON names.
+//
+// Unset fields that belong to a oneof (including proto3 optional fields) and missing map entries are omitted.
+// Other unset fields of message type are null, and unset scalar fields have their default values.
+func Select(msg proto.Message, paths ...string) (*structpb.Struct, error) {
+	m := msg.ProtoReflect()
+	selection := map[string]interface{}{}
+
+	for _, path := range paths {
+		if err := Validate(m.Descriptor(), path); err != nil {
+			return nil, err
+		}
+
+		fields, err := selectMessage(m, splitPath(path))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to select %s", path)
+		}
+
+		merge(selection, fields)
+	}
+
+	return structpb.NewStruct(selection)
+}
+
+// Validate checks that paths can be selected from messages with the specified descriptor.
+// It returns an error that wraps ErrBadMask if they can't.
+func Validate(desc protoreflect.MessageDescriptor, paths ...string) error {
+	for _, path := range paths {
+		if err := validatePath(desc, splitPath(path)); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrBadMask, path, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func validatePath(desc protoreflect.MessageDescriptor, segments []string) error {
+	for len(segments) > 0 {
+		field, oneof := findField(desc, segments[0])
+
+		switch {
+		case oneof != nil && len(segments) > 1:
+			return errors.Errorf("oneof %s can't have subfields", oneof.Name())
+		case oneof != nil:
+			return nil
+		case field == nil:
+			return errors.Errorf("%s has no field %s", desc.FullName(), segments[0])
+		}
+
+		segments = segments[1:]
+
+		switch {
+		case field.IsList() && len(segments) > 0:
+			if segments[0] != wildcard {
+				return errors.Errorf("elements of repeated field %s must be selected with %s", field.Name(), wildcard)
+			}
+
+			segments = segments[1:]
+		case field.IsMap() && len(segments) > 0:
+			if segments[0] != wildcard {
+				if _, err := mapKey(field.MapKey(), segments[0]); err != nil {
+					return err
+				}
+			}
+
+			segments = segments[1:]
+			field = field.MapValue()
+		}
+
+		if len(segments) == 0 {
+			return nil
+		}
+
+		if field.Message() == nil {
+			return errors.Errorf("field %s isn't a message", field.Name())
+		}
+
+		desc = field.Message()
+	}
+
+	return errors.New("empty path")
+}
+
+// selectMessage returns an object with the field of msg named by the first segment. Remaining segments select
+// values from that field.
+func selectMessage(msg protoreflect.Message, segments []string) (map[string]interface{}, error) {
+	name := segments[0]
+	field, oneof := findField(msg.Descriptor(), name)
+
+	if oneof != nil {
+		field = msg.WhichOneof(oneof)
+	}
+
+	if field == nil || (field.ContainingOneof() != nil && !msg.Has(field)) {
+		return map[string]interface{}{}, nil
+	}
+
+	value, err := selectField(msg, field, segments[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{name: value}, nil
+}
+
+func selectField(msg protoreflect.Message, field protoreflect.FieldDescriptor, segments []string) (interface{}, error) {
+	value := msg.Get(field)
+
+	switch {
+	case field.IsList():
+		return selectList(value.List(), field, segments)
+	case field.IsMap():
+		return selectMap(value.Map(), field, segments)
+	default:
+		return selectValue(value, field, msg.Has(field), segments)
+	}
+}
+
+func selectList(list protoreflect.List, field protoreflect.FieldDescriptor, segments []string) (interface{}, error) {
+	if len(segments) > 0 {
+		// Skip the wildcard.
+		segments = segments[1:]
+	}
+
+	values := make([]interface{}, list.Len())
+
+	for i := range values {
+		value, err := selectValue(list.Get(i), field, true, segments)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+func selectMap(entries protoreflect.Map, field protoreflect.FieldDescriptor, segments []string) (interface{}, error) {
+	values := map[string]interface{}{}
+
+	if len(segments) > 0 && segments[0] != wildcard {
+		key, err := mapKey(field.MapKey(), segments[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if entries.Has(key) {
+			value, err := selectValue(entries.Get(key), field.MapValue(), true, segments[1:])
+			if err != nil {
+				return nil, err
+			}
+
+			values[segments[0]] = value
+		}
+
+		return values, nil
+	}
+
+	if len(segments) > 0 {
+		// Skip the wildcard.
+		segments = segments[1:]
+	}
+
+	var err error
+
+	entries.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		values[key.String()], err = selectValue(value, field.MapValue(), true, segments)
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// selectValue converts a value of the specified field, or selects from it if it's a message and segments aren't
+// empty.
+func selectValue(
+	value protoreflect.Value,
+	field protoreflect.FieldDescriptor,
+	has bool,
+	segments []string,
+) (interface{}, error) {
+	if field.Message() == nil {
+		return scalarValue(value, field), nil
+	}
+
+	if len(segments) > 0 {
+		return selectMessage(value.Message(), segments)
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return messageValue(value.Message())
+}
+
+// messageValue converts a message to an object keyed by the JSON names of its populated fields.
+// Well-known types are converted to their JSON representation.
+func messageValue(msg protoreflect.Message) (interface{}, error) {
+	desc := msg.Descriptor()
+
+	if isWrapper(desc) {
+		field := desc.Fields().ByName("value")
+		return scalarValue(msg.Get(field), field), nil
+	}
+
+	if isWellKnown(desc) {
+		return wellKnownValue(msg)
+	}
+
+	values := map[string]interface{}{}
+
+	var err error
+
+	msg.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		values[field.JSONName()], err = selectField(msg, field, nil)
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func wellKnownValue(msg protoreflect.Message) (interface{}, error) {
+	buf, err := protojson.Marshal(msg.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(buf, &value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func scalarValue(value protoreflect.Value, field protoreflect.FieldDescriptor) interface{} {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return value.Bool()
+	case protoreflect.EnumKind:
+		if enum := field.Enum().Values().ByNumber(value.Enum()); enum != nil {
+			return string(enum.Name())
+		}
+
+		return int64(value.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return value.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return value.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return floatValue(value.Float())
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes())
+	default:
+		return value.String()
+	}
+}
+
+// floatValue returns f, or its JSON string representation if it isn't a finite number.
+func floatValue(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	default:
+		return f
+	}
+}
+
+// findField returns the field or oneof with the specified JSON name or .proto name.
+func findField(
+	desc protoreflect.MessageDescriptor,
+	name string,
+) (protoreflect.FieldDescriptor, protoreflect.OneofDescriptor) {
+	fields := desc.Fields()
+
+	if field := fields.ByJSONName(name); field != nil {
+		return field, nil
+	}
+
+	if field := fields.ByTextName(name); field != nil {
+		return field, nil
+	}
+
+	if oneof := desc.Oneofs().ByName(protoreflect.Name(name)); oneof != nil && !oneof.IsSynthetic() {
+		return nil, oneof
+	}
+
+	return nil, nil
+}
+
+func mapKey(field protoreflect.FieldDescriptor, key string) (protoreflect.MapKey, error) {
+	var (
+		value protoreflect.Value
+		err   error
+	)
+
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(key)
+		value = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var i int64
+		i, err = strconv.ParseInt(key, 10, 32)
+		value = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var i int64
+		i, err = strconv.ParseInt(key, 10, 64)
+		value = protoreflect.ValueOfInt64(i)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var u uint64
+		u, err = strconv.ParseUint(key, 10, 32)
+		value = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var u uint64
+		u, err = strconv.ParseUint(key, 10, 64)
+		value = protoreflect.ValueOfUint64(u)
+	default:
+		value = protoreflect.ValueOfString(key)
+	}
+
+	if err != nil {
+		return protoreflect.MapKey{}, errors.Errorf("invalid %s map key %q", field.Kind(), key)
+	}
+
+	return value.MapKey(), nil
+}
+
+func isWrapper(desc protoreflect.MessageDescriptor) bool {
+	switch desc.FullName() {
+	case "google.protobuf.BoolValue", "google.protobuf.BytesValue", "google.protobuf.DoubleValue",
+		"google.protobuf.FloatValue", "google.protobuf.Int32Value", "google.protobuf.Int64Value",
+		"google.protobuf.StringValue", "google.protobuf.UInt32Value", "google.protobuf.UInt64Value":
+		return true
+	default:
+		return false
+	}
+}
+
+func isWellKnown(desc protoreflect.MessageDescriptor) bool {
+	switch desc.FullName() {
+	case "google.protobuf.Any", "google.protobuf.Duration", "google.protobuf.Empty", "google.protobuf.FieldMask",
+		"google.protobuf.ListValue", "google.protobuf.Struct", "google.protobuf.Timestamp", "google.protobuf.Value":
+		return true
+	default:
+		return false
+	}
+}
+
+// merge adds the values in src to dst. Objects are merged recursively, as are the elements of lists with the same
+// length. Other values in src replace those in dst.
+func merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dst[key] = mergeValue(dst[key], value)
+	}
+}
+
+func mergeValue(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		if d, ok := dst.(map[string]interface{}); ok {
+			merge(d, s)
+			return d
+		}
+	case []interface{}:
+		if d, ok := dst.([]interface{}); ok && len(d) == len(s) {
+			for i := range s {
+				d[i] = mergeValue(d[i], s[i])
+			}
+
+			return d
+		}
+	}
+
+	return src
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, pathSeparator)
+}
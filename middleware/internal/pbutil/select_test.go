@@ -0,0 +1,280 @@
+package pbutil_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal/pbutil"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestFieldMaskIsValid(t *testing.T) {
+	msg := &authorizer.IsRequest{
+		PolicyContext: &api.PolicyContext{
+			Id:   "policyID",
+			Path: "policy.path",
+		},
+		IdentityContext: &api.IdentityContext{
+			Type:     api.IdentityType_IDENTITY_TYPE_SUB,
+			Identity: "username",
+		},
+	}
+
+	var msgType *authorizer.IsRequest
+
+	mask, err := fieldmaskpb.New(
+		msgType,
+		"policy_context.path",
+		"identity_context.identity",
+		"resource_context",
+		"policy_context.id",
+	)
+
+	assert.NoError(t, err, "failed to create field mask")
+	assert.True(t, mask.IsValid(msg), "invalid mask")
+
+	mask.Normalize()
+
+	testCase := func(paths []string, expected map[string]interface{}) func(t *testing.T) {
+		return func(t *testing.T) {
+			selection, err := pbutil.Select(msg, paths...)
+			assert.NoError(t, err, "select failed on policy_context.path")
+
+			actual := selection.AsMap()
+
+			assert.True(t, reflect.DeepEqual(expected, actual), "wrong selection")
+		}
+	}
+
+	t.Run("single value", testCase(
+		[]string{"policy_context.path"},
+		map[string]interface{}{
+			"policy_context": map[string]interface{}{
+				"path": "policy.path",
+			},
+		},
+	))
+	t.Run("multiple values", testCase(
+		[]string{"policy_context.path", "identity_context.identity"},
+		map[string]interface{}{
+			"policy_context": map[string]interface{}{
+				"path": "policy.path",
+			},
+			"identity_context": map[string]interface{}{
+				"identity": "username",
+			},
+		},
+	))
+	t.Run("struct value", testCase(
+		[]string{"policy_context"},
+		map[string]interface{}{
+			"policy_context": map[string]interface{}{
+				"id":   "policyID",
+				"path": "policy.path",
+			},
+		},
+	))
+}
+
+func TestSelectRepeated(t *testing.T) {
+	msg := &authorizer.IsResponse{
+		Decisions: []*authorizer.Decision{{Decision: "allowed", Is: true}, {Decision: "visible"}},
+	}
+
+	selection, err := pbutil.Select(msg, "decisions.*.decision")
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"decisions": []interface{}{
+				map[string]interface{}{"decision": "allowed"},
+				map[string]interface{}{"decision": "visible"},
+			},
+		},
+		selection.AsMap(),
+	)
+
+	selection, err = pbutil.Select(msg, "decisions.*.decision", "decisions.*.is")
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"decisions": []interface{}{
+				map[string]interface{}{"decision": "allowed", "is": true},
+				map[string]interface{}{"decision": "visible", "is": false},
+			},
+		},
+		selection.AsMap(),
+		"paths with a common prefix should be merged",
+	)
+}
+
+func TestSelectMapAndOneof(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"name": "Dune",
+		"tags": []interface{}{"books", "scifi"},
+		"meta": map[string]interface{}{"pages": 412},
+	})
+	require.NoError(t, err)
+
+	t.Run("map entry", func(t *testing.T) {
+		selection, err := pbutil.Select(msg, "fields.name.stringValue")
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			map[string]interface{}{
+				"fields": map[string]interface{}{"name": map[string]interface{}{"stringValue": "Dune"}},
+			},
+			selection.AsMap(),
+		)
+	})
+
+	t.Run("map wildcard and oneof", func(t *testing.T) {
+		selection, err := pbutil.Select(msg, "fields.*.kind")
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			map[string]interface{}{
+				"fields": map[string]interface{}{
+					"name": map[string]interface{}{"kind": "Dune"},
+					"tags": map[string]interface{}{"kind": []interface{}{"books", "scifi"}},
+					"meta": map[string]interface{}{"kind": map[string]interface{}{"pages": float64(412)}},
+				},
+			},
+			selection.AsMap(),
+		)
+	})
+
+	t.Run("unset oneof members should be omitted", func(t *testing.T) {
+		selection, err := pbutil.Select(msg, "fields.name.number_value")
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			map[string]interface{}{"fields": map[string]interface{}{"name": map[string]interface{}{}}},
+			selection.AsMap(),
+		)
+	})
+
+	t.Run("missing map keys should be omitted", func(t *testing.T) {
+		selection, err := pbutil.Select(msg, "fields.missing")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"fields": map[string]interface{}{}}, selection.AsMap())
+	})
+}
+
+func TestSelectScalarsAndWellKnownTypes(t *testing.T) {
+	msg := newEvent(t)
+
+	selection, err := pbutil.Select(msg, "created", "count", "level", "payload", "optional_note")
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		map[string]interface{}{
+			"created": "2022-03-04T05:06:07Z",
+			"count":   float64(3),
+			"level":   "TRACE_LEVEL_FULL",
+			"payload": "aGVsbG8=",
+		},
+		selection.AsMap(),
+	)
+}
+
+func TestValidate(t *testing.T) {
+	desc := (&authorizer.IsResponse{}).ProtoReflect().Descriptor()
+
+	assert.NoError(t, pbutil.Validate(desc, "decisions", "decisions.*.is"))
+	assert.ErrorIs(t, pbutil.Validate(desc, "decisions.0.is"), pbutil.ErrBadMask)
+	assert.ErrorIs(t, pbutil.Validate(desc, "decisions.*.missing"), pbutil.ErrBadMask)
+	assert.ErrorIs(t, pbutil.Validate(desc, "decisions.*.is.value"), pbutil.ErrBadMask)
+
+	structDesc := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	assert.NoError(t, pbutil.Validate(structDesc, "fields.*.kind", "fields.key.stringValue"))
+	assert.ErrorIs(t, pbutil.Validate(structDesc, "fields.*.kind.value"), pbutil.ErrBadMask)
+}
+
+// newEvent returns a dynamic message with well-known type, wrapper, enum, bytes, and proto3 optional fields.
+func newEvent(t *testing.T) proto.Message {
+	type fieldType = descriptorpb.FieldDescriptorProto_Type
+
+	optional := func(name string, number int32, typ fieldType, typeName string) *descriptorpb.FieldDescriptorProto {
+		field := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+
+		if typeName != "" {
+			field.TypeName = proto.String(typeName)
+		}
+
+		return field
+	}
+
+	note := optional("optional_note", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	note.Proto3Optional = proto.Bool(true)
+	note.OneofIndex = proto.Int32(0)
+
+	file, err := protodesc.NewFile(
+		&descriptorpb.FileDescriptorProto{
+			Name:    proto.String("example/event.proto"),
+			Package: proto.String("example"),
+			Syntax:  proto.String("proto3"),
+			Dependency: []string{
+				"google/protobuf/timestamp.proto",
+				"google/protobuf/wrappers.proto",
+				"aserto/authorizer/authorizer/v1/authorizer.proto",
+			},
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					optional(
+						"created",
+						1,
+						descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+						".google.protobuf.Timestamp",
+					),
+					optional("count", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Int32Value"),
+					optional(
+						"level",
+						3,
+						descriptorpb.FieldDescriptorProto_TYPE_ENUM,
+						".aserto.authorizer.authorizer.v1.TraceLevel",
+					),
+					optional("payload", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+					note,
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("_optional_note")}},
+			}},
+		},
+		protoregistry.GlobalFiles,
+	)
+	require.NoError(t, err)
+
+	msg := dynamicpb.NewMessage(file.Messages().ByName("Event"))
+	fields := msg.Descriptor().Fields()
+
+	created := timestamppb.New(time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC))
+	msg.Set(fields.ByName("created"), protoreflect.ValueOfMessage(created.ProtoReflect()))
+	msg.Set(fields.ByName("count"), protoreflect.ValueOfMessage(wrapperspb.Int32(3).ProtoReflect()))
+	msg.Set(fields.ByName("level"), protoreflect.ValueOfEnum(authorizer.TraceLevel_TRACE_LEVEL_FULL.Number()))
+	msg.Set(fields.ByName("payload"), protoreflect.ValueOfBytes([]byte("hello")))
+
+	return msg
+}
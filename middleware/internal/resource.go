@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+)
+
+// DefaultMaxBodySize is the default number of bytes that HTTP resource mappers read from request bodies.
+const DefaultMaxBodySize = 1 << 20
+
+// BodyFields returns the values of fields in a JSON request body. Fields are selected by dot-separated paths
+// (e.g. "product.id") and are returned in a map with the same nesting. Fields that aren't present are omitted.
+//
+// At most maxBytes bytes of the body are read. Larger bodies, and bodies that aren't JSON, yield no fields.
+// The request body is replaced so handlers can read it in full.
+func BodyFields(r *http.Request, maxBytes int64, paths []string) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if r.Body == nil || r.Body == http.NoBody || !isJSON(r.Header.Get("Content-Type")) {
+		return fields
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	r.Body = &rebufferedBody{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+
+	if err != nil {
+		return fields
+	}
+
+	return JSONFields(r.Header.Get("Content-Type"), buf, maxBytes, paths)
+}
+
+// JSONFields is like BodyFields for servers that have already read the request body.
+func JSONFields(contentType string, body []byte, maxBytes int64, paths []string) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	if !isJSON(contentType) || int64(len(body)) > maxBytes {
+		return fields
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return fields
+	}
+
+	return SelectFields(values, paths)
+}
+
+// SelectFields returns the values of fields in a decoded JSON object. Fields are selected by dot-separated paths
+// (e.g. "product.id") and are returned in a map with the same nesting. Fields that aren't present are omitted.
+func SelectFields(values map[string]interface{}, paths []string) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	for _, path := range paths {
+		if value, ok := Lookup(values, path); ok {
+			setPath(fields, path, value)
+		}
+	}
+
+	return fields
+}
+
+// QueryFields returns the values of query string parameters. Parameters with a single value are returned as strings
+// and parameters with multiple values as lists. Parameters that aren't present are omitted.
+func QueryFields(r *http.Request, params []string) map[string]interface{} {
+	fields := map[string]interface{}{}
+	query := r.URL.Query()
+
+	for _, param := range params {
+		values, ok := query[param]
+		if !ok {
+			continue
+		}
+
+		if len(values) == 1 {
+			fields[param] = values[0]
+			continue
+		}
+
+		list := make([]interface{}, len(values))
+		for i, value := range values {
+			list[i] = value
+		}
+
+		fields[param] = list
+	}
+
+	return fields
+}
+
+// HeaderFields returns the values of request headers, keyed by the specified header names.
+// Headers that aren't present are omitted.
+func HeaderFields(r *http.Request, headers []string) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	for _, header := range headers {
+		if value := r.Header.Get(header); value != "" {
+			fields[header] = value
+		}
+	}
+
+	return fields
+}
+
+// MergeResource adds fields to a resource, resolving fields that are already present using the specified rule.
+// Only resource itself is modified. Nested objects are copied before others are merged into them, because mappers
+// may return maps that are shared between requests.
+func MergeResource(resource, fields map[string]interface{}, conflict middleware.ResourceConflict) {
+	for key, value := range fields {
+		existing, ok := resource[key]
+		if !ok {
+			resource[key] = value
+			continue
+		}
+
+		switch conflict {
+		case middleware.ResourceKeepFirst:
+			// Keep the existing value.
+		case middleware.ResourceDeepMerge:
+			existingObj, ok1 := existing.(map[string]interface{})
+			valueObj, ok2 := value.(map[string]interface{})
+
+			if ok1 && ok2 {
+				merged := make(map[string]interface{}, len(existingObj)+len(valueObj))
+				for k, v := range existingObj {
+					merged[k] = v
+				}
+
+				MergeResource(merged, valueObj, conflict)
+				resource[key] = merged
+			} else {
+				resource[key] = value
+			}
+		default:
+			resource[key] = value
+		}
+	}
+}
+
+type rebufferedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Lookup returns the value at a dot-separated path (e.g. "product.id") in a decoded JSON object.
+func Lookup(value map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = value
+
+	for _, segment := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = obj[segment]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func setPath(fields map[string]interface{}, path string, value interface{}) {
+	segments := strings.Split(path, ".")
+
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := fields[segment].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			fields[segment] = next
+		}
+
+		fields = next
+	}
+
+	fields[segments[len(segments)-1]] = value
+}
@@ -0,0 +1,30 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeResourceDoesNotModifyFields(t *testing.T) {
+	// Mappers may return the same maps for every request.
+	first := map[string]interface{}{
+		"order": map[string]interface{}{"id": "42", "item": map[string]interface{}{"id": "7"}},
+	}
+	second := map[string]interface{}{"order": map[string]interface{}{"item": map[string]interface{}{"count": 2}}}
+
+	for i := 0; i < 2; i++ {
+		resource := map[string]interface{}{}
+		internal.MergeResource(resource, first, middleware.ResourceDeepMerge)
+		internal.MergeResource(resource, second, middleware.ResourceDeepMerge)
+
+		assert.Equal(t, map[string]interface{}{
+			"order": map[string]interface{}{"id": "42", "item": map[string]interface{}{"id": "7", "count": 2}},
+		}, resource)
+	}
+
+	assert.Equal(t, map[string]interface{}{"id": "42", "item": map[string]interface{}{"id": "7"}}, first["order"])
+	assert.Equal(t, map[string]interface{}{"item": map[string]interface{}{"count": 2}}, second["order"])
+}
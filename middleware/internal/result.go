@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	authz "github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+)
+
+// Is sends an authorization request and returns its result, including the latency of the call.
+func Is(
+	ctx context.Context,
+	client authz.AuthorizerClient,
+	req *authz.IsRequest,
+) (*middleware.AuthorizationResult, error) {
+	start := time.Now()
+
+	resp, err := client.Is(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &middleware.AuthorizationResult{
+		Identity:  req.IdentityContext,
+		Policy:    req.PolicyContext,
+		Resource:  req.ResourceContext,
+		Decisions: resp.Decisions,
+		Latency:   time.Since(start),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+const signatureSeparator = "."
+
+// SignValue returns a value signed with HMAC-SHA256, in the form "<value>.<signature>" where the signature is
+// unpadded base64url.
+func SignValue(key []byte, value string) string {
+	return value + signatureSeparator + base64.RawURLEncoding.EncodeToString(signature(key, value))
+}
+
+// VerifySignedValue returns the value of a signed value created by SignValue, or false if its signature doesn't match
+// any of the keys.
+func VerifySignedValue(signed string, keys [][]byte) (string, bool) {
+	sep := strings.LastIndex(signed, signatureSeparator)
+	if sep <= 0 {
+		return "", false
+	}
+
+	value := signed[:sep]
+
+	sig, err := base64.RawURLEncoding.DecodeString(signed[sep+1:])
+	if err != nil {
+		return "", false
+	}
+
+	for _, key := range keys {
+		if hmac.Equal(sig, signature(key, value)) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+func signature(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return mac.Sum(nil)
+}
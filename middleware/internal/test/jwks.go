@@ -0,0 +1,84 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	Issuer   = "https://issuer.example.com"
+	Audience = "https://api.example.com"
+
+	keyID   = "test-key"
+	keySize = 2048
+)
+
+// JWKS is a local JWKS server that publishes a single RSA signing key.
+type JWKS struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+}
+
+// NewJWKS starts a JWKS server. It is closed when the test completes.
+func NewJWKS(t *testing.T) *JWKS {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	require.NoError(t, err)
+
+	public, err := jwk.New(key.Public())
+	require.NoError(t, err)
+	require.NoError(t, public.Set(jwk.KeyIDKey, keyID))
+	require.NoError(t, public.Set(jwk.AlgorithmKey, jwa.RS256))
+
+	set := jwk.NewSet()
+	set.Add(public)
+
+	body, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body) // nolint:errcheck
+	}))
+	t.Cleanup(server.Close)
+
+	return &JWKS{Server: server, key: key}
+}
+
+// Token returns a token for the default username signed with the server's key.
+// Claims can be added or overridden using the claims argument.
+func (s *JWKS) Token(t *testing.T, claims map[string]interface{}) string {
+	return Sign(t, s.key, claims)
+}
+
+// Sign returns a token for the default username signed with the specified key.
+func Sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	token := jwt.New()
+	require.NoError(t, token.Set(jwt.SubjectKey, DefaultUsername))
+	require.NoError(t, token.Set(jwt.IssuerKey, Issuer))
+	require.NoError(t, token.Set(jwt.AudienceKey, Audience))
+	require.NoError(t, token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour)))
+
+	for name, value := range claims {
+		require.NoError(t, token.Set(name, value))
+	}
+
+	private, err := jwk.New(key)
+	require.NoError(t, err)
+	require.NoError(t, private.Set(jwk.KeyIDKey, keyID))
+
+	signed, err := jwt.Sign(token, jwa.RS256, private)
+	require.NoError(t, err)
+
+	return string(signed)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrUnauthenticated is returned by middleware when a caller's JWT fails verification. gRPC middleware returns it
+// with the status code UNAUTHENTICATED and HTTP middleware responds with status 401.
+var ErrUnauthenticated = cerr.ErrAuthenticationFailed.WithGRPCStatus(codes.Unauthenticated)
+
+// JWTVerifierOptions configure the claims that a JWTVerifier validates.
+type JWTVerifierOptions struct {
+	// Issuer is the expected value of the "iss" claim. If empty, the issuer isn't validated.
+	Issuer string
+
+	// Audience is a value that must be present in the "aud" claim. If empty, the audience isn't validated.
+	Audience string
+
+	// AcceptableSkew is the clock skew tolerated when validating the "exp", "nbf", and "iat" claims.
+	AcceptableSkew time.Duration
+
+	// RefreshInterval is the minimum time between refreshes of keys fetched from a URL. Keys are refreshed
+	// according to the cache headers of the JWKS response, but no more often than RefreshInterval.
+	// If zero, the minimum interval is one hour.
+	RefreshInterval time.Duration
+}
+
+// JWTVerifier verifies the signatures of JWTs against the keys in a JSON Web Key Set (JWKS) and validates their
+// claims. Tokens must have an expiration time.
+//
+// Identity builders use a JWTVerifier to reject requests with invalid tokens before calling the authorizer.
+type JWTVerifier struct {
+	keys    func(context.Context) (jwk.Set, error)
+	options JWTVerifierOptions
+}
+
+// NewJWKSVerifier returns a JWTVerifier that fetches keys from the specified JWKS URL.
+// Keys are cached and refreshed in the background until ctx is done.
+//
+// An error is returned if the initial fetch fails.
+func NewJWKSVerifier(ctx context.Context, url string, options JWTVerifierOptions) (*JWTVerifier, error) {
+	refresh := jwk.NewAutoRefresh(ctx)
+
+	if options.RefreshInterval > 0 {
+		refresh.Configure(url, jwk.WithMinRefreshInterval(options.RefreshInterval))
+	} else {
+		refresh.Configure(url)
+	}
+
+	if _, err := refresh.Refresh(ctx, url); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS from %s: %w", url, err)
+	}
+
+	return &JWTVerifier{
+		keys: func(ctx context.Context) (jwk.Set, error) {
+			return refresh.Fetch(ctx, url)
+		},
+		options: options,
+	}, nil
+}
+
+// NewJWKSFileVerifier returns a JWTVerifier that uses the keys in a local JWKS file.
+func NewJWKSFileVerifier(path string, options JWTVerifierOptions) (*JWTVerifier, error) {
+	keys, err := jwk.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS from %s: %w", path, err)
+	}
+
+	return &JWTVerifier{
+		keys: func(context.Context) (jwk.Set, error) {
+			return keys, nil
+		},
+		options: options,
+	}, nil
+}
+
+// Verify parses a JWT, verifies its signature, and validates its claims.
+//
+// Errors caused by invalid tokens wrap ErrUnauthenticated. Other errors, like failures to fetch keys, don't.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (jwt.Token, error) {
+	keys, err := v.keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JWKS: %w", err)
+	}
+
+	options := []jwt.ParseOption{
+		jwt.WithKeySet(keys),
+		jwt.UseDefaultKey(true),
+		jwt.WithValidate(true),
+		jwt.WithContext(ctx),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithAcceptableSkew(v.options.AcceptableSkew),
+	}
+
+	if v.options.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.options.Issuer))
+	}
+
+	if v.options.Audience != "" {
+		options = append(options, jwt.WithAudience(v.options.Audience))
+	}
+
+	parsed, err := jwt.ParseString(token, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthenticated, err.Error())
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,18 @@
+package middleware
+
+// MappingFailure determines how middleware responds to requests when a resource or identity mapper returns an error.
+type MappingFailure int
+
+const (
+	// MappingFailureError rejects requests with status 500 in HTTP middleware and INTERNAL in gRPC middleware.
+	// This is the default.
+	MappingFailureError MappingFailure = iota
+
+	// MappingFailureDeny rejects requests as if the authorizer had denied them, with status 403 in HTTP middleware
+	// and PERMISSION_DENIED in gRPC middleware.
+	MappingFailureDeny
+
+	// MappingFailureInvalidArgument rejects requests with status 400 in HTTP middleware and INVALID_ARGUMENT in gRPC
+	// middleware. The mapper's error message is included in the response.
+	MappingFailureInvalidArgument
+)
@@ -0,0 +1,171 @@
+package mq
+
+import (
+	"context"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+)
+
+// IdentityMapper is the type of callback functions that can inspect messages and set the caller's identity.
+type IdentityMapper func(context.Context, Message, middleware.Identity)
+
+// IdentityMapperE is like IdentityMapper but can return an error if the caller's identity can't be determined.
+type IdentityMapperE func(context.Context, Message, middleware.Identity) error
+
+// IdentityBuilder is used to configure what information about caller identity is sent in authorization calls.
+//
+// It provides the same options as the gRPC and net/http identity builders, reading the identity from message headers
+// and payloads.
+type IdentityBuilder struct {
+	builder internal.IdentityBuilder[Message]
+}
+
+// Static values
+
+// Call JWT() to indicate that the user's identity is expressed as a string-encoded JWT.
+//
+// JWT() is always called in conjunction with another method that provides the user ID itself.
+// For example:
+//
+//  idBuilder.JWT().FromHeader("Authorization")
+func (b *IdentityBuilder) JWT() *IdentityBuilder {
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_JWT)
+	return b
+}
+
+// Call Subject() to indicate that the user's identity is a subject name (email, userid, etc.).
+//
+// Subject() is always used in conjunction with another method that provides the user ID itself.
+// For example:
+//
+//  idBuilder.Subject().FromField("requested_by")
+func (b *IdentityBuilder) Subject() *IdentityBuilder {
+	b.builder.SetType(api.IdentityType_IDENTITY_TYPE_SUB)
+	return b
+}
+
+// Call None() to indicate that messages are unauthenticated.
+func (b *IdentityBuilder) None() *IdentityBuilder {
+	b.builder.None()
+	return b
+}
+
+// Call ID(...) to set the user's identity. If neither JWT() or Subject() are called too, the identity type
+// is inferred from the identity: values that parse as JWTs are sent as JWTs and other values as subjects.
+// Passing an empty string is the same as calling .None() and results in an authorization check for anonymous access.
+func (b *IdentityBuilder) ID(identity string) *IdentityBuilder {
+	b.builder.SetID(identity)
+	return b
+}
+
+// FromHeader retrieves caller identity from message headers.
+//
+// Headers are attempted in order. The first non-empty header is used.
+// If none of the specified headers have a value, the message is considered anonymous.
+// The "Bearer" authentication scheme is removed from the value of the Authorization header.
+func (b *IdentityBuilder) FromHeader(header ...string) *IdentityBuilder {
+	return b.Mapper(func(_ context.Context, msg Message, identity middleware.Identity) {
+		for _, h := range header {
+			if id := internal.IdentityValue(h, msg.Header(h)); id != "" {
+				identity.ID(id)
+				return
+			}
+		}
+
+		identity.None()
+	})
+}
+
+// FromField retrieves caller identity from a string field in the message payload, selected by a dot-separated path
+// (e.g. "metadata.token").
+//
+// If the field isn't present or isn't a string, the message is considered anonymous.
+func (b *IdentityBuilder) FromField(path string) *IdentityBuilder {
+	return b.MapperE(func(_ context.Context, msg Message, identity middleware.Identity) error {
+		fields, err := msg.Fields(path)
+		if err != nil {
+			return err
+		}
+
+		id, _ := internal.Lookup(fields, path)
+		if s, ok := id.(string); ok {
+			identity.ID(s)
+			return nil
+		}
+
+		identity.None()
+
+		return nil
+	})
+}
+
+// FromContextValue extracts caller identity from a value in the context passed to `Middleware.Authorize()`.
+//
+// If the value is not present, not a string, or an empty string then the message is considered anonymous.
+func (b *IdentityBuilder) FromContextValue(key interface{}) *IdentityBuilder {
+	return b.Mapper(func(ctx context.Context, _ Message, identity middleware.Identity) {
+		identity.ID(internal.ValueOrEmpty(ctx, key))
+	})
+}
+
+// FirstOf retrieves caller identity from an ordered list of sources. Each source is an IdentityBuilder with its own
+// identity type and source. The first source that yields an identity is used.
+// If none of the sources yield an identity, the message is considered anonymous.
+//
+// Sources that don't have an identity type use the type of the builder that FirstOf is called on.
+// Each source is verified and transformed with its own settings. The verifier of the builder that FirstOf is called on
+// only applies to tokens from sources that don't have one, and its transforms apply to subjects from any source.
+func (b *IdentityBuilder) FirstOf(sources ...*IdentityBuilder) *IdentityBuilder {
+	builders := make([]*internal.IdentityBuilder[Message], len(sources))
+	for i, source := range sources {
+		builders[i] = &source.builder
+	}
+
+	b.builder.SetSources(builders...)
+
+	return b
+}
+
+// Transform adds functions that post-process the caller's identity before it is sent to the authorizer.
+// Transforms are applied in order, after JWT verification and subject extraction. They only apply to subject
+// identities; JWTs are sent unchanged.
+func (b *IdentityBuilder) Transform(transforms ...middleware.IdentityTransform) *IdentityBuilder {
+	b.builder.AddTransforms(transforms...)
+	return b
+}
+
+// Mapper takes a custom IdentityMapper to be used for extracting identity information from messages.
+func (b *IdentityBuilder) Mapper(mapper IdentityMapper) *IdentityBuilder {
+	return b.MapperE(func(ctx context.Context, msg Message, identity middleware.Identity) error {
+		mapper(ctx, msg, identity)
+		return nil
+	})
+}
+
+// MapperE takes a custom IdentityMapperE to be used for extracting identity information from messages.
+// If the mapper returns an error, `Middleware.Authorize()` returns it without calling the authorizer.
+func (b *IdentityBuilder) MapperE(mapper IdentityMapperE) *IdentityBuilder {
+	b.builder.SetMapper(func(ctx context.Context, msg Message, identity middleware.Identity) error {
+		return mapper(ctx, msg, identity)
+	})
+
+	return b
+}
+
+// VerifyJWT instructs the builder to verify caller JWTs using the specified verifier.
+// Messages with invalid tokens are rejected with an error wrapping middleware.ErrUnauthenticated before the
+// authorizer is called.
+//
+// If the identity type is subject, the verified token's subject is sent to the authorizer instead of the token.
+func (b *IdentityBuilder) VerifyJWT(verifier *middleware.JWTVerifier) *IdentityBuilder {
+	b.builder.SetVerifier(verifier)
+	return b
+}
+
+// Resolve constructs an IdentityContext that can be used in authorization requests.
+// If JWT verification is enabled, an error wrapping middleware.ErrUnauthenticated is returned for invalid tokens.
+func (b *IdentityBuilder) Resolve(ctx context.Context, msg Message) (*api.IdentityContext, error) {
+	return b.builder.Resolve(ctx, msg)
+}
@@ -0,0 +1,102 @@
+package mq
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/aserto-go/middleware/internal/pbutil"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// Message is a message consumed from a queue. It provides access to the message's headers and payload, independently
+// of the message broker and payload encoding.
+//
+// ProtoMessage and JSONMessage create messages with protobuf and JSON payloads. Other encodings can be supported by
+// implementing the interface.
+type Message interface {
+	// Header returns the value of a message header (e.g. a message attribute or property), or an empty string if the
+	// header isn't present.
+	Header(name string) string
+
+	// Fields returns the values of payload fields selected by dot-separated paths (e.g. "order.id"). Fields are
+	// returned in a map with the same nesting as in the payload. Fields that aren't present are omitted.
+	Fields(paths ...string) (map[string]interface{}, error)
+}
+
+// Headers holds the headers of a message. Header names are case-insensitive.
+type Headers map[string]string
+
+// Get returns the value of a header, or an empty string if the header isn't present.
+func (h Headers) Get(name string) string {
+	if value, ok := h[name]; ok {
+		return value
+	}
+
+	for key, value := range h {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// ProtoMessage returns a message with a protobuf payload.
+//
+// Payload fields are identified using their JSON names or their names in the .proto file. Elements of repeated fields
+// and values of map fields are selected with the "*" wildcard (e.g. "items.*.id").
+func ProtoMessage(payload proto.Message, headers Headers) Message {
+	return &protoMessage{Headers: headers, payload: payload}
+}
+
+// JSONMessage returns a message with a JSON payload. The payload must be a JSON object.
+func JSONMessage(payload []byte, headers Headers) Message {
+	return &jsonMessage{Headers: headers, payload: payload}
+}
+
+type protoMessage struct {
+	Headers
+	payload proto.Message
+}
+
+func (m *protoMessage) Header(name string) string {
+	return m.Get(name)
+}
+
+func (m *protoMessage) Fields(paths ...string) (map[string]interface{}, error) {
+	if len(paths) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	fields, err := pbutil.Select(m.payload, paths...)
+	if err != nil {
+		name := m.payload.ProtoReflect().Descriptor().FullName()
+		return nil, errors.Wrapf(err, "failed to select fields from %s", name)
+	}
+
+	return fields.AsMap(), nil
+}
+
+type jsonMessage struct {
+	Headers
+	payload []byte
+}
+
+func (m *jsonMessage) Header(name string) string {
+	return m.Get(name)
+}
+
+func (m *jsonMessage) Fields(paths ...string) (map[string]interface{}, error) {
+	if len(paths) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(m.payload, &values); err != nil {
+		return nil, errors.Wrap(err, "failed to parse message payload")
+	}
+
+	return internal.SelectFields(values, paths), nil
+}
@@ -0,0 +1,252 @@
+/*
+Package mq authorizes messages consumed from message queues.
+
+Workers that process commands from queues can apply the same authorization checks as gRPC and HTTP servers. The
+middleware reads the caller's identity from message headers or payloads, builds the resource context from selected
+message fields, and calls the Aserto authorizer:
+
+  mw := mq.New(authClient, middleware.Policy{ID: "policyId", Path: "myapp.orders.create", Decision: "allowed"})
+  mw.Identity.JWT().FromHeader("Authorization")
+  mw.WithResourceFromFields("order.account_id")
+
+  for delivery := range deliveries {
+    allowed, err := mw.Authorize(ctx, mq.JSONMessage(delivery.Body, headers(delivery)))
+    ...
+  }
+
+The package doesn't depend on any message broker. Messages are accessed through the Message interface, with
+adapters for protobuf and JSON payloads.
+*/
+package mq
+
+import (
+	"context"
+	"time"
+
+	"github.com/aserto-dev/aserto-go/middleware"
+	"github.com/aserto-dev/aserto-go/middleware/internal"
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/aserto-dev/go-utils/cerr"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type (
+	Policy           = middleware.Policy
+	AuthorizerClient = authorizer.AuthorizerClient
+)
+
+/*
+Middleware authorizes messages consumed from message queues.
+
+To authorize messages, the middleware needs information about:
+
+1. The user that sent the message.
+
+2. The Aserto authorization policy to evaluate.
+
+3. Optional, additional input data to the authorization policy.
+
+The values for these parameters can be set globally or extracted dynamically from messages.
+*/
+type Middleware struct {
+	// Identity determines the caller identity used in authorization calls.
+	Identity *IdentityBuilder
+
+	client          AuthorizerClient
+	policy          api.PolicyContext
+	policyMapper    StringMapper
+	resourceMappers []ResourceMapperE
+	hooks           internal.Hooks
+}
+
+type (
+	// StringMapper functions are used to extract string values from messages.
+	// They are used to define policy mappers.
+	StringMapper func(context.Context, Message) string
+
+	// ResourceMapper functions are used to extract structured data from messages.
+	ResourceMapper func(context.Context, Message, map[string]interface{})
+
+	// ResourceMapperE is like ResourceMapper but can return an error if the resource can't be determined.
+	ResourceMapperE func(context.Context, Message, map[string]interface{}) error
+)
+
+// New creates middleware for the specified policy.
+//
+// The new middleware reads the caller's identity from the "Authorization" message header. It can be overridden
+// using `Middleware.Identity`, and the middleware's ".With...()" functions set policy path and resource mappers.
+func New(client AuthorizerClient, policy Policy) *Middleware {
+	return &Middleware{
+		client:   client,
+		Identity: (&IdentityBuilder{}).FromHeader("Authorization"),
+		policy:   *internal.DefaultPolicyContext(policy),
+	}
+}
+
+// WithPolicyPathMapper takes a custom StringMapper for extracting the authorization policy path from messages.
+// For example, to evaluate a policy for each type of command:
+//
+//  mw.WithPolicyPathMapper(func(_ context.Context, msg mq.Message) string {
+//    return "myapp.commands." + msg.Header("command")
+//  })
+func (m *Middleware) WithPolicyPathMapper(mapper StringMapper) *Middleware {
+	m.policyMapper = mapper
+	return m
+}
+
+/*
+WithResourceFromFields instructs the middleware to select the specified fields from message payloads and
+use them as the resource in authorization calls. Fields are selected by dot-separated paths.
+
+Example:
+
+  mw.WithResourceFromFields("order.id", "account")
+
+This call would result in an authorization resource with the following structure:
+
+  {
+    "order": {
+      "id": <value from message>
+    },
+    "account": <value from message>
+  }
+
+Objects selected by several calls are merged, so calling WithResourceFromFields("order.id") and then
+WithResourceFromFields("order.account") adds both fields to "order".
+*/
+func (m *Middleware) WithResourceFromFields(fields ...string) *Middleware {
+	return m.WithResourceMapperE(func(_ context.Context, msg Message, res map[string]interface{}) error {
+		values, err := msg.Fields(fields...)
+		if err != nil {
+			return err
+		}
+
+		internal.MergeResource(res, values, middleware.ResourceDeepMerge)
+
+		return nil
+	})
+}
+
+// WithResourceFromHeaders instructs the middleware to add the values of message headers to the resource context.
+// Each header is added using its name as the key. Headers that aren't present are omitted.
+func (m *Middleware) WithResourceFromHeaders(headers ...string) *Middleware {
+	return m.WithResourceMapper(func(_ context.Context, msg Message, res map[string]interface{}) {
+		for _, header := range headers {
+			if value := msg.Header(header); value != "" {
+				res[header] = value
+			}
+		}
+	})
+}
+
+// WithResourceFromContextValue instructs the middleware to read the specified value from the context passed to
+// Authorize and add it to the authorization resource context.
+func (m *Middleware) WithResourceFromContextValue(ctxKey interface{}, field string) *Middleware {
+	return m.WithResourceMapper(func(ctx context.Context, _ Message, res map[string]interface{}) {
+		if v := ctx.Value(ctxKey); v != nil {
+			res[field] = v
+		}
+	})
+}
+
+// WithResourceMapper takes a custom ResourceMapper for extracting the authorization resource context from messages.
+func (m *Middleware) WithResourceMapper(mapper ResourceMapper) *Middleware {
+	return m.WithResourceMapperE(func(ctx context.Context, msg Message, res map[string]interface{}) error {
+		mapper(ctx, msg, res)
+		return nil
+	})
+}
+
+// WithResourceMapperE is like WithResourceMapper for mappers that can fail. If the mapper returns an error, the
+// message isn't authorized and Authorize returns the error.
+func (m *Middleware) WithResourceMapperE(mapper ResourceMapperE) *Middleware {
+	m.resourceMappers = append(m.resourceMappers, mapper)
+	return m
+}
+
+// WithHook registers a hook that is called after each message is authorized.
+func (m *Middleware) WithHook(hook middleware.Hook) *Middleware {
+	m.hooks = append(m.hooks, hook)
+	return m
+}
+
+// Authorize checks whether a message is allowed to be processed. It returns true if the authorizer allows it.
+//
+// Messages from callers with invalid tokens are rejected with an error wrapping middleware.ErrUnauthenticated.
+// Errors are also returned if the identity or resource can't be read from the message, or if the authorization call
+// fails.
+func (m *Middleware) Authorize(ctx context.Context, msg Message) (bool, error) {
+	start := time.Now()
+	event := &middleware.Event{Outcome: middleware.OutcomeDenied}
+
+	defer m.hooks.Report(ctx, event, start)
+
+	allowed, err := m.is(ctx, msg, event)
+
+	switch {
+	case errors.Is(err, middleware.ErrUnauthenticated):
+		event.Outcome = middleware.OutcomeUnauthenticated
+	case err != nil:
+		event.Outcome = middleware.OutcomeError
+	case allowed:
+		event.Outcome = middleware.OutcomeAllowed
+	}
+
+	event.Err = err
+
+	return allowed, err
+}
+
+func (m *Middleware) is(ctx context.Context, msg Message, event *middleware.Event) (bool, error) {
+	policy := &api.PolicyContext{
+		Id:        m.policy.Id,
+		Path:      m.policy.Path,
+		Decisions: m.policy.Decisions,
+	}
+
+	if m.policyMapper != nil {
+		policy.Path = m.policyMapper(ctx, msg)
+	}
+
+	event.Operation = policy.Path
+	event.PolicyPath = policy.Path
+
+	identity, err := m.Identity.Resolve(ctx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	resource, err := m.resourceContext(ctx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := internal.Is(ctx, m.client, &authorizer.IsRequest{
+		IdentityContext: identity,
+		PolicyContext:   policy,
+		ResourceContext: resource,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "authorization call failed")
+	}
+
+	if len(result.Decisions) != 1 {
+		return false, cerr.ErrInvalidDecision
+	}
+
+	return result.Decisions[0].Is, nil
+}
+
+func (m *Middleware) resourceContext(ctx context.Context, msg Message) (*structpb.Struct, error) {
+	res := map[string]interface{}{}
+
+	for _, mapper := range m.resourceMappers {
+		if err := mapper(ctx, msg, res); err != nil {
+			return nil, internal.MapperFailed(err)
+		}
+	}
+
+	return structpb.NewStruct(res)
+}
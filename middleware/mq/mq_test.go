@@ -0,0 +1,98 @@
+package mq_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aserto-dev/aserto-go/middleware/internal/mock"
+	"github.com/aserto-dev/aserto-go/middleware/internal/test"
+	"github.com/aserto-dev/aserto-go/middleware/mq"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestJSONMessage(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"order":    map[string]interface{}{"id": "42"},
+		"x-tenant": "acme",
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.orders.create"), test.Resource(resource))
+	mw := mq.New(mock.New(t, expected, test.Decision(true)), test.Policy("myapp.orders.create")).
+		WithResourceFromFields("order.id", "order.missing").
+		WithResourceFromHeaders("x-tenant", "x-missing")
+
+	msg := mq.JSONMessage(
+		[]byte(`{"order": {"id": "42", "total": 100}}`),
+		mq.Headers{"authorization": "Bearer " + test.DefaultUsername, "X-Tenant": "acme"},
+	)
+
+	allowed, err := mw.Authorize(context.Background(), msg)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestResourceFromSeveralFields(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{
+		"order": map[string]interface{}{"id": "42", "account": "acme"},
+	})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.orders.create"), test.Resource(resource))
+	mw := mq.New(mock.New(t, expected, test.Decision(true)), test.Policy("myapp.orders.create")).
+		WithResourceFromFields("order.id").
+		WithResourceFromFields("order.account")
+
+	msg := mq.JSONMessage(
+		[]byte(`{"order": {"id": "42", "account": "acme", "total": 100}}`),
+		mq.Headers{"Authorization": test.DefaultUsername},
+	)
+
+	allowed, err := mw.Authorize(context.Background(), msg)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestProtoMessage(t *testing.T) {
+	resource, err := structpb.NewStruct(map[string]interface{}{"path": "orders"})
+	require.NoError(t, err)
+
+	expected := test.Request(test.PolicyPath("myapp.commands.cancel"), test.Resource(resource))
+	mw := mq.New(mock.New(t, expected, test.Decision(true)), test.Policy("")).
+		WithPolicyPathMapper(func(_ context.Context, msg mq.Message) string {
+			return "myapp.commands." + msg.Header("command")
+		}).
+		WithResourceFromFields("path")
+	mw.Identity.Subject().FromField("id")
+
+	payload := &api.PolicyContext{Id: test.DefaultUsername, Path: "orders"}
+	msg := mq.ProtoMessage(payload, mq.Headers{"command": "cancel"})
+
+	allowed, err := mw.Authorize(context.Background(), msg)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestDenied(t *testing.T) {
+	expected := test.Request(test.PolicyPath("myapp.orders.delete"))
+	mw := mq.New(mock.New(t, expected, test.Decision(false)), test.Policy("myapp.orders.delete"))
+
+	msg := mq.JSONMessage([]byte(`{}`), mq.Headers{"Authorization": test.DefaultUsername})
+
+	allowed, err := mw.Authorize(context.Background(), msg)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestInvalidPayload(t *testing.T) {
+	mw := mq.New(mock.New(t, nil), test.Policy("myapp.orders.create")).WithResourceFromFields("order.id")
+
+	msg := mq.JSONMessage([]byte(`not json`), mq.Headers{"Authorization": test.DefaultUsername})
+
+	allowed, err := mw.Authorize(context.Background(), msg)
+	assert.Error(t, err)
+	assert.False(t, allowed)
+}
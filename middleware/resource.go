@@ -0,0 +1,17 @@
+package middleware
+
+// ResourceConflict determines how HTTP middleware combines fields with the same name that are produced by different
+// resource mappers.
+type ResourceConflict int
+
+const (
+	// ResourceOverwrite replaces fields set by earlier mappers with fields from later mappers. This is the default.
+	ResourceOverwrite ResourceConflict = iota
+
+	// ResourceKeepFirst keeps fields set by earlier mappers and ignores fields with the same name from later mappers.
+	ResourceKeepFirst
+
+	// ResourceDeepMerge merges objects recursively. Other fields from later mappers replace those from earlier
+	// mappers.
+	ResourceDeepMerge
+)
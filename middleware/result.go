@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/aserto-dev/go-grpc-authz/aserto/authorizer/authorizer/v1"
+	"github.com/aserto-dev/go-grpc/aserto/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// AuthorizationResult holds the inputs and outputs of the authorization call made for an allowed request.
+// Middleware stores it in the request context so handlers can use it without repeating the work.
+type AuthorizationResult struct {
+	// Identity is the caller identity sent to the authorizer.
+	Identity *api.IdentityContext
+
+	// Policy is the policy context sent to the authorizer, including the evaluated policy path and decisions.
+	Policy *api.PolicyContext
+
+	// Resource is the resource context sent to the authorizer.
+	Resource *structpb.Struct
+
+	// Decisions are the results returned by the authorizer.
+	Decisions []*authorizer.Decision
+
+	// Latency is the duration of the authorization call.
+	Latency time.Duration
+}
+
+// Decision returns the result of the named decision and whether it was returned by the authorizer.
+func (r *AuthorizationResult) Decision(name string) (is, ok bool) {
+	for _, decision := range r.Decisions {
+		if decision.Decision == name {
+			return decision.Is, true
+		}
+	}
+
+	return false, false
+}
+
+type resultKey struct{}
+
+// ContextWithAuthorizationResult returns a copy of ctx that holds the specified authorization result.
+func ContextWithAuthorizationResult(ctx context.Context, result *AuthorizationResult) context.Context {
+	return context.WithValue(ctx, resultKey{}, result)
+}
+
+// AuthorizationResultFromContext returns the authorization result stored in ctx by authorization middleware.
+// It returns false if the request wasn't authorized, e.g. because it is exempt.
+func AuthorizationResultFromContext(ctx context.Context) (*AuthorizationResult, bool) {
+	result, ok := ctx.Value(resultKey{}).(*AuthorizationResult)
+	return result, ok
+}
+
+// IdentityFromContext returns the caller identity sent to the authorizer for the request associated with ctx.
+func IdentityFromContext(ctx context.Context) (*api.IdentityContext, bool) {
+	result, ok := AuthorizationResultFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return result.Identity, true
+}
+
+// PolicyFromContext returns the policy context sent to the authorizer for the request associated with ctx.
+func PolicyFromContext(ctx context.Context) (*api.PolicyContext, bool) {
+	result, ok := AuthorizationResultFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return result.Policy, true
+}
+
+// ResourceFromContext returns the resource context sent to the authorizer for the request associated with ctx.
+func ResourceFromContext(ctx context.Context) (*structpb.Struct, bool) {
+	result, ok := AuthorizationResultFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	return result.Resource, true
+}